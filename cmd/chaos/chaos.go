@@ -1,26 +1,117 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/swarm-chaos/internal/engine"
 	"github.com/livepeer/swarm-chaos/internal/engine/drivers/docker"
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/fake"
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/k8s"
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/local"
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/proxy"
 	"github.com/livepeer/swarm-chaos/internal/model"
 )
 
+// driverOptions configures playground drivers
+type driverOptions struct {
+	agent      string
+	links      []string
+	processes  string
+	kubeconfig string
+	namespace  string
+	entities   string
+	// clock is virtual clock of the simulation, only
+	// fake driver can be used if it is set
+	clock model.Clock
+}
+
+// stringsFlag is a flag that can be specified multiple times
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(value string) error {
+	*sf = append(*sf, value)
+	return nil
+}
+
 func main() {
 	flag.Set("logtostderr", "true")
 	intMin := flag.String("int_min", "", "Interval, min")
 	intMax := flag.String("int_max", "", "Interval, max")
 	fKey := flag.String("f_key", "", "Label key")
 	fVal := flag.String("f_val", "", "Label val")
+	fType := flag.String("f_type", "", "Entity type (container, process, task, vm), vms are only selected if it is vm, processes are matched by name, e.g. -f_type process -f_name ffmpeg")
+	fName := flag.String("f_name", "", "Entity name pattern")
+	fParent := flag.String("f_parent", "", "Label of one of the entity's ancestors, key=value")
+	fState := flag.String("f_state", "", "State of the entities: running or any, by default only running entities are destroyed")
+	fPlayground := flag.String("f_playground", "", "Name of the playground entities belong to")
+	maxAffected := flag.Int("max_affected", 0, "Maximum number of entities kept affected at once, operations over it are refused, 0 for no limit")
+	op := flag.String("op", "destroy", "Operation to do on the entities (destroy, stop, pause, drain, ...)")
+	var opParams stringsFlag
+	flag.Var(&opParams, "op_param", "Parameter of the operation, key=value, overrides driver's default, can be repeated, e.g. -op_param duration=5m")
+	signal := flag.String("signal", "", "Signal sent by the kill operation, SIGKILL by default")
+	graceful := flag.Bool("graceful", false, "Stop containers before removing them on destroy")
+	opTimeout := flag.String("operation_timeout", engine.OperationTimeout.String(), "Timeout of the operations, comma-separated, with optional operation name, e.g. 30s,destroy=10s,stress_cpu=2m")
+	statusTimeout := flag.Duration("status_timeout", engine.StatusTimeout, "Timeout of getting status of the entity")
+	stopTimeout := flag.Duration("stop_timeout", docker.StopTimeout, "Time container has to stop by stop, restart and graceful destroy before it is killed")
+	retries := flag.Int("retries", engine.Retry.Attempts, "Maximum number of attempts of listing and operations failed with transient errors, 1 to not retry")
+	retryBackoff := flag.Duration("retry_backoff", engine.Retry.Backoff, "Delay before the first retry, doubled on every next one and jittered")
+	retryMaxBackoff := flag.Duration("retry_max_backoff", engine.Retry.MaxBackoff, "Maximum delay between retries")
+	httpTimeout := flag.Duration("http_timeout", docker.HTTPTimeout, "Timeout of the requests to the agent, should be longer than stop_timeout")
+	duration := flag.Duration("duration", docker.FaultDuration, "Duration of the bounded faults (stress, slowdown, blackhole, throttle, skew_clock)")
+	stressCPUs := flag.Int("stress_cpus", docker.Stress.CPUs, "Number of cores to burn by stress_cpu")
+	stressMemory := flag.Int("stress_memory", docker.Stress.MemoryMB, "Megabytes of memory to allocate by stress_memory")
+	stressDiskPath := flag.String("stress_disk_path", docker.Stress.DiskPath, "Directory to fill by stress_disk")
+	stressDisk := flag.Int("stress_disk", docker.Stress.DiskMB, "Megabytes to write by stress_disk")
+	slowCPUs := flag.Float64("slow_cpus", docker.Slowdown.CPUs, "Number of CPUs slowed down container can use, 0 to keep")
+	slowShares := flag.Int64("slow_cpu_shares", docker.Slowdown.CPUShares, "CPU shares of slowed down container, 0 to keep")
+	slowMemory := flag.Int("slow_memory", docker.Slowdown.MemoryMB, "Memory limit of slowed down container in megabytes, 0 to keep. Only containers already having a limit are limited, docker can't remove it afterwards")
+	slowBlkio := flag.Uint("slow_blkio_weight", uint(docker.Slowdown.BlkioWeight), "Block IO weight of slowed down container (10-1000), 0 to keep")
+	blackhole := flag.String("blackhole", strings.Join(docker.BlackholeTargets, ","), "Comma-separated destinations (host[:port], cidr[:port], dns for all names or dns:name for one) made unreachable by blackhole")
+	throttleRate := flag.String("throttle_rate", docker.Throttle.Rate, "Bandwidth cap set by throttle, in tc format (1mbit, 500kbit)")
+	throttleDir := flag.String("throttle_direction", "both", "Direction throttled: egress, ingress or both")
+	skewOffset := flag.Duration("skew_offset", docker.ClockSkew.Offset, "Offset the clock is shifted by skew_clock, can be negative")
+	skewFile := flag.String("skew_file", docker.ClockSkew.File, "libfaketime timestamp file inside the containers")
+	helperImage := flag.String("helper_image", docker.HelperImage, "Image of the sidecar used to inject network faults, should have iptables and tc")
+	var links stringsFlag
+	flag.Var(&links, "link", "Link proxied by the proxy driver, name=listen->upstream, can be repeated")
+	proxyLatency := flag.Duration("proxy_latency", proxy.Faults.Latency, "Latency added by slowdown of the proxied link")
+	proxyJitter := flag.Duration("proxy_jitter", proxy.Faults.Jitter, "Maximum random addition to proxy_latency")
+	proxyRate := flag.Int64("proxy_rate", proxy.Faults.Rate, "Bandwidth in bytes per second set by throttle of the proxied link")
+	proxySliceSize := flag.Int("proxy_slice_size", proxy.Faults.SliceSize, "Size of the slices data is cut to by slice of the proxied link")
+	proxySliceDelay := flag.Duration("proxy_slice_delay", proxy.Faults.SliceDelay, "Delay between slices")
+	proxyTimeout := flag.Duration("proxy_timeout", proxy.Faults.Timeout, "Connections are closed after being held that long by timeout, 0 to hold until fault ends")
+	processes := flag.String("processes", "", "JSON file with processes managed by the local driver")
+	kubeconfig := flag.String("kubeconfig", "", "Kubeconfig used by the k8s driver, in-cluster config is used if empty")
+	namespace := flag.String("namespace", "", "Namespace the k8s driver works in, all namespaces if empty")
+	fakeEntities := flag.String("fake_entities", "", "JSON file with entities of the fake driver, used to rehearse scenarios")
+	scaleDownBy := flag.Int("scale_down_by", int(k8s.ScaleDownBy), "Number of replicas removed by scale_down")
+	driver := flag.String("driver", "docker", "Playground driver: docker, proxy, local, k8s or fake")
+	var playgrounds stringsFlag
+	flag.Var(&playgrounds, "playground", "Named playground, name=driver[,option], can be repeated. Option is agent URL for docker, processes file for local, kubeconfig for k8s and entities file for fake. Overrides driver")
 	agent := flag.String("agent", "tcp://localhost:9001", "URL of the agent")
 	server := flag.Bool("server", false, "Start in server mode")
+	scenariosFile := flag.String("scenarios", "", "JSON file with scenarios the server starts with, array of {name, description, tasks}")
+	simulate := flag.Duration("simulate", 0, "Simulate task against fake playgrounds for that long in virtual time and print the timeline, e.g. 24h")
+	seed := flag.Int64("seed", 1, "Random seed of the simulation")
 	version := flag.Bool("version", false, "Print out the version")
+	output := flag.String("output", "table", "Output format of the entities subcommand: table, json or yaml")
 
+	// chaos entities [flags] lists entities selected by the f_* flags
+	listEntities := len(os.Args) > 1 && os.Args[1] == entitiesCommand
+	if listEntities {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	flag.Parse()
 
 	if *version {
@@ -34,17 +125,140 @@ func main() {
 	if *agent != "" {
 		docker.AgentHost = *agent
 	}
+	if *signal != "" {
+		if _, err := model.ParseSignal(*signal); err != nil {
+			glog.Info(err)
+			return
+		}
+		docker.KillSignal = *signal
+		local.KillSignal = *signal
+		k8s.KillSignal = *signal
+	}
+	k8s.ScaleDownBy = int32(*scaleDownBy)
+	opts := driverOptions{
+		agent:      docker.AgentHost,
+		links:      links,
+		processes:  *processes,
+		kubeconfig: *kubeconfig,
+		namespace:  *namespace,
+		entities:   *fakeEntities,
+	}
+	docker.GracefulDestroy = *graceful
+	if err := engine.ParseOperationTimeouts(*opTimeout); err != nil {
+		glog.Info(err)
+		return
+	}
+	engine.StatusTimeout = *statusTimeout
+	if *retries < 1 {
+		glog.Infof("Bad number of retries %d", *retries)
+		return
+	}
+	engine.Retry = engine.RetryConfig{
+		Attempts:   *retries,
+		Backoff:    *retryBackoff,
+		MaxBackoff: *retryMaxBackoff,
+	}
+	docker.StopTimeout = *stopTimeout
+	docker.HTTPTimeout = *httpTimeout
+	docker.FaultDuration = *duration
+	docker.Stress = docker.StressConfig{
+		CPUs:     *stressCPUs,
+		MemoryMB: *stressMemory,
+		DiskPath: *stressDiskPath,
+		DiskMB:   *stressDisk,
+	}
+	docker.Slowdown = docker.SlowdownConfig{
+		CPUs:        *slowCPUs,
+		CPUShares:   *slowShares,
+		MemoryMB:    *slowMemory,
+		BlkioWeight: uint16(*slowBlkio),
+	}
+	docker.BlackholeTargets = strings.Split(*blackhole, ",")
+	docker.HelperImage = *helperImage
+	docker.ClockSkew = docker.ClockSkewConfig{
+		Offset: *skewOffset,
+		File:   *skewFile,
+	}
+	egress, ingress, err := docker.ParseThrottleDirection(*throttleDir)
+	if err != nil {
+		glog.Info(err)
+		return
+	}
+	docker.Throttle = docker.ThrottleConfig{
+		Rate:    *throttleRate,
+		Egress:  egress,
+		Ingress: ingress,
+	}
+	proxy.Faults = proxy.FaultConfig{
+		Latency:    *proxyLatency,
+		Jitter:     *proxyJitter,
+		Rate:       *proxyRate,
+		SliceSize:  *proxySliceSize,
+		SliceDelay: *proxySliceDelay,
+		Timeout:    *proxyTimeout,
+		Duration:   *duration,
+	}
 
 	if *server {
-		dp, err := docker.NewDockerPlayground()
+		ce, err := newChaosEngine(*driver, playgrounds, opts)
 		if err != nil {
 			panic(err)
 		}
-		scheduler := engine.NewScheduler(dp)
+		scheduler := engine.NewScheduler(ce)
 		server := engine.NewServer(scheduler)
+		if *scenariosFile != "" {
+			scenarios, err := engine.LoadScenarios(*scenariosFile)
+			if err != nil {
+				glog.Info(err)
+				return
+			}
+			if err := server.AddScenarios(scenarios); err != nil {
+				glog.Infof("Bad scenarios in %s: %v", *scenariosFile, err)
+				return
+			}
+			glog.Infof("Loaded %d scenarios from %s", len(scenarios), *scenariosFile)
+		}
 		server.StartServer()
 		return
 	}
+	var labels map[string]string
+	if *fKey != "" {
+		labels = map[string]string{*fKey: *fVal}
+	}
+	selector := engine.Selector{
+		Labels:     labels,
+		Type:       *fType,
+		Name:       *fName,
+		Playground: *fPlayground,
+		State:      *fState,
+	}
+	if *fParent != "" {
+		kv := strings.SplitN(*fParent, "=", 2)
+		if len(kv) != 2 {
+			glog.Info("f_parent must be in key=value form")
+			return
+		}
+		selector.Ancestors = []engine.Selector{{Labels: map[string]string{kv[0]: kv[1]}}}
+	}
+	if listEntities {
+		if err := checkOutput(*output); err != nil {
+			glog.Info(err)
+			return
+		}
+		ce, err := newChaosEngine(*driver, playgrounds, opts)
+		if err != nil {
+			panic(err)
+		}
+		entities, err := engine.NewScheduler(ce).Entities(context.Background(), selector, true)
+		if err != nil {
+			glog.Info(err)
+			return
+		}
+		if err := printEntities(os.Stdout, entities, *output); err != nil {
+			glog.Info(err)
+		}
+		return
+	}
 	if *intMin == "" {
 		glog.Info("int_min must be specified")
 		return
@@ -53,138 +267,140 @@ func main() {
 		glog.Info("int_max must be specified")
 		return
 	}
-	if *fKey == "" {
-		glog.Info("f_key must be specified")
+	// entities are selected by label, type, name or ancestors, at least one of them
+	if *fKey == "" && *fType == "" && *fName == "" && *fParent == "" {
+		glog.Info("f_key, f_type, f_name or f_parent must be specified")
 		return
 	}
-	if *fVal == "" {
+	if *fKey != "" && *fVal == "" {
 		glog.Info("f_val must be specified")
 		return
 	}
-	dp, err := docker.NewDockerPlayground()
+	opType, err := model.ParseOperationType(*op)
+	if err != nil {
+		glog.Info(err)
+		return
+	}
+	params, err := model.ParseParams(opParams)
+	if err != nil {
+		glog.Info(err)
+		return
+	}
+	operation := model.Operation{Type: opType, Params: params}
+	var clock *engine.SimClock
+	if *simulate > 0 {
+		clock = engine.NewSimClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		opts.clock = clock
+	}
+	ce, err := newChaosEngine(*driver, playgrounds, opts)
 	if err != nil {
 		panic(err)
 	}
-	scheduler := engine.NewScheduler(dp)
-	err = scheduler.ScheduleTask(*intMin, *intMax, model.OperationTypeDestroy, *fKey, *fVal)
+	scheduler := engine.NewScheduler(ce)
+	err = scheduler.ScheduleTask(*intMin, *intMax, operation, selector, *maxAffected)
 	if err != nil {
 		panic(err)
 	}
+	if clock != nil {
+		timeline, err := scheduler.Simulate(clock, *simulate, *seed)
+		if err != nil {
+			panic(err)
+		}
+		for _, e := range timeline {
+			fmt.Println(e)
+		}
+		return
+	}
 	scheduler.StartTasks()
 
 	runtime.Goexit()
+}
 
-	/*
-		engine := engine.NewChaosEngine()
-		dp, err := docker.NewDockerPlayground()
-		if err != nil {
-			panic(err)
+// newChaosEngine creates engine with playgrounds specified in
+// name=driver[,option] form, or with single playground of the
+// driver named after it, if there are none
+func newChaosEngine(driver string, playgrounds []string, opts driverOptions) (*engine.ChaosEngine, error) {
+	if len(playgrounds) == 0 {
+		playgrounds = []string{driver + "=" + driver}
+	}
+	ce := engine.NewChaosEngine()
+	for _, pg := range playgrounds {
+		kv := strings.SplitN(pg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Bad playground %q, should be name=driver[,option]", pg)
 		}
-		engine.AddPlayground(dp)
-		ents, err := engine.EntitiesByLabel("type", "transcoder")
-		// ents, err := engine.Entities()
-		if err != nil {
-			panic(err)
+		name := kv[0]
+		pgOpts := opts
+		do := strings.SplitN(kv[1], ",", 2)
+		if len(do) == 2 {
+			switch do[0] {
+			case "docker":
+				pgOpts.agent = do[1]
+			case "local":
+				pgOpts.processes = do[1]
+			case "k8s":
+				pgOpts.kubeconfig = do[1]
+			case "fake":
+				pgOpts.entities = do[1]
+			default:
+				return nil, fmt.Errorf("Driver %s of playground %s doesn't take options", do[0], name)
+			}
 		}
-		for _, ent := range ents {
-			fmt.Printf("Container named %s\n", ent.Name())
-			fmt.Printf("Container %s has labels:\n", ent.Name())
-			fmt.Printf("%+v\n", ent.Labels())
+		playground, err := newPlayground(do[0], pgOpts)
+		if err != nil {
+			return nil, fmt.Errorf("Playground %s: %v", name, err)
 		}
-		if len(ents) > 0 {
-			ent := ents[0]
-			fmt.Printf("Killing %s\n", ent.Name())
-			// err := ent.Do(model.OperationTypeDestroy)
-			// if err != nil {
-			// 	panic(err)
-			// }
+		if err := ce.AddPlayground(name, playground); err != nil {
+			return nil, err
 		}
-	*/
+	}
+	return ce, nil
+}
 
-	/*
-		ctx := context.Background()
-		cli, err := client.NewClientWithOpts(client.FromEnv)
-		// cli, err := client.NewClientWithOpts(client.W)
-		if err != nil {
-			panic(err)
+func newPlayground(driver string, opts driverOptions) (model.Playground, error) {
+	if opts.clock != nil && driver != "fake" {
+		return nil, fmt.Errorf("Only fake driver can be used in simulation, not %s", driver)
+	}
+	switch driver {
+	case "docker":
+		return docker.NewDockerPlaygroundForAgent(opts.agent)
+	case "proxy":
+		configs := make([]proxy.LinkConfig, 0, len(opts.links))
+		for _, l := range opts.links {
+			lc, err := proxy.ParseLinkConfig(l)
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, lc)
 		}
-		cli.NegotiateAPIVersion(ctx)
-		swa, err := cli.SwarmInspect(context.Background())
-		if err != nil {
-			panic(err)
+		return proxy.NewProxyPlayground(configs)
+	case "local":
+		if opts.processes == "" {
+			return nil, fmt.Errorf("processes must be specified for local driver")
 		}
-		fmt.Printf("swarm id: %s\n", swa.ID)
-		fmt.Printf("Swarm info: %+v\n", swa)
-
-		containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{})
+		configs, err := local.LoadConfig(opts.processes)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-
-		// Вывод всех идентификаторов контейнеров
-		for _, container := range containers {
-			fmt.Println(container.ID)
-			fmt.Printf("state: %s status: %s\n", container.State, container.Status)
-			for _, node := range container.Names {
-				fmt.Println(node)
-			}
+		return local.NewLocalPlayground(configs)
+	case "k8s":
+		return k8s.NewKubernetesPlaygroundFromKubeconfig(opts.kubeconfig, opts.namespace)
+	case "fake":
+		if opts.entities == "" {
+			return nil, fmt.Errorf("fake_entities must be specified for fake driver")
 		}
-	*/
-
-	/*
-		ctx := context.Background()
-		cli, err := client.NewClientWithOpts(client.FromEnv)
+		configs, err := fake.LoadConfig(opts.entities)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		cli.NegotiateAPIVersion(ctx)
-
-		containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{})
+		fp, err := fake.NewFakePlayground(configs)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-
-		// Вывод всех идентификаторов контейнеров
-		for _, container := range containers {
-			fmt.Println(container.ID)
-			fmt.Printf("state: %s status: %s\n", container.State, container.Status)
-			for _, node := range container.Names {
-				fmt.Println(node)
-			}
+		if opts.clock != nil {
+			fp.SetClock(opts.clock)
 		}
-
-			reader, err := cli.ImagePull(ctx, "docker.io/library/alpine", types.ImagePullOptions{})
-			if err != nil {
-				panic(err)
-			}
-			io.Copy(os.Stdout, reader)
-
-			resp, err := cli.ContainerCreate(ctx, &container.Config{
-				Image: "alpine",
-				Cmd:   []string{"echo", "hello world"},
-			}, nil, nil, "")
-			if err != nil {
-				panic(err)
-			}
-
-			if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-				panic(err)
-			}
-
-			statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-			select {
-			case err := <-errCh:
-				if err != nil {
-					panic(err)
-				}
-			case <-statusCh:
-			}
-
-			out, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true})
-			if err != nil {
-				panic(err)
-			}
-
-			stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-	*/
+		return fp, nil
+	}
+	return nil, fmt.Errorf("Unknown driver %q", driver)
 }
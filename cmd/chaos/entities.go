@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/livepeer/swarm-chaos/internal/engine"
+	"sigs.k8s.io/yaml"
+)
+
+// entitiesCommand is name of the subcommand listing entities
+const entitiesCommand = "entities"
+
+// checkOutput checks output format of the entities subcommand
+func checkOutput(output string) error {
+	switch output {
+	case "table", "json", "yaml":
+		return nil
+	}
+	return fmt.Errorf("Bad output %q, should be table, json or yaml", output)
+}
+
+// printEntities writes entities to w as a table, JSON or YAML
+func printEntities(w io.Writer, entities []engine.EntityInfo, output string) error {
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(entities, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "yaml":
+		b, err := yaml.Marshal(entities)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tID\tNODE\tTYPE\tSTATUS\tLABELS")
+	for _, e := range entities {
+		status := e.Status
+		if e.StatusError != "" {
+			status = "error"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.ID, orDash(e.Node), e.Type, orDash(status), formatLabels(e.Labels))
+	}
+	return tw.Flush()
+}
+
+// formatLabels returns labels as sorted key=value list
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
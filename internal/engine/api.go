@@ -0,0 +1,604 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// apiPrefix is prefix of the versioned API's paths
+const apiPrefix = "/v1"
+
+type (
+	// apiHandler handles request to the route, params are
+	// values of the path parameters
+	apiHandler func(w http.ResponseWriter, r *http.Request, params map[string]string)
+
+	// route is an API endpoint, routes are also
+	// used to generate the OpenAPI document
+	route struct {
+		method string
+		// path with parameters in braces, like /tasks/{id}
+		path    string
+		summary string
+		// query parameters, name to description
+		query map[string]string
+		// request is value of request body's type, nil if there is no body
+		request interface{}
+		// status of the successful response
+		status int
+		// response is value of response body's type, nil if there is no body
+		response interface{}
+		handler  apiHandler
+	}
+
+	// apiRouter dispatches requests to the routes
+	apiRouter struct {
+		routes []route
+	}
+
+	// APIError is body of the error responses
+	APIError struct {
+		Error string `json:"error"`
+	}
+
+	// SchedulerState is state of the scheduler
+	SchedulerState struct {
+		Running bool `json:"running"`
+		Tasks   int  `json:"tasks"`
+		// Degraded is number of degraded tasks
+		Degraded int `json:"degraded"`
+		// UnhealthyNodes is number of nodes which APIs fail
+		UnhealthyNodes int `json:"unhealthy_nodes"`
+	}
+
+	// SchedulerUpdate starts or stops the tasks
+	SchedulerUpdate struct {
+		Running bool `json:"running"`
+	}
+
+	// RevertResult tells how many operations were reverted
+	RevertResult struct {
+		Reverted int    `json:"reverted"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	// VersionInfo is version of the server
+	VersionInfo struct {
+		Version  string `json:"version,omitempty"`
+		OS       string `json:"os,omitempty"`
+		ARCH     string `json:"arch,omitempty"`
+		Compiler string `json:"compiler,omitempty"`
+		Runtime  string `json:"runtime,omitempty"`
+	}
+)
+
+// routes returns endpoints of the versioned API
+func (srv *Server) routes() []route {
+	return []route{
+		{method: "GET", path: "/tasks", summary: "List scheduled tasks",
+			status: http.StatusOK, response: []TaskStatus{}, handler: srv.listTasks},
+		{method: "POST", path: "/tasks", summary: "Schedule task, it is started at once if scheduler is running",
+			request: TaskSpec{}, status: http.StatusCreated, response: TaskStatus{}, handler: srv.createTask},
+		{method: "DELETE", path: "/tasks", summary: "Stop and remove all the tasks",
+			status: http.StatusNoContent, handler: srv.clearTasks},
+		{method: "GET", path: "/tasks/{id}", summary: "Get task",
+			status: http.StatusOK, response: TaskStatus{}, handler: srv.getTask},
+		{method: "DELETE", path: "/tasks/{id}", summary: "Stop and remove task",
+			status: http.StatusNoContent, handler: srv.deleteTask},
+		{method: "GET", path: "/scheduler", summary: "Get state of the scheduler",
+			status: http.StatusOK, response: SchedulerState{}, handler: srv.getScheduler},
+		{method: "PUT", path: "/scheduler", summary: "Start or stop the tasks by setting running",
+			request: SchedulerUpdate{}, status: http.StatusOK, response: SchedulerState{}, handler: srv.putScheduler},
+		{method: "GET", path: "/entities", summary: "List entities of the playgrounds matching the selector",
+			query: map[string]string{
+				"type":       "Type of the entities",
+				"name":       "Glob pattern of the entities' names",
+				"playground": "Name of the playground entities belong to",
+				"state":      "State of the entities: running or any, any by default",
+				"label":      "Label of the entities, key=value, can be repeated",
+				"parent":     "Label of one of the entities' ancestors, key=value, can be repeated",
+				"status":     "Get statuses of the entities if true",
+			},
+			status: http.StatusOK, response: []EntityInfo{}, handler: srv.listEntities},
+		{method: "GET", path: "/entities/{entity_id}", summary: "Get entity with its status",
+			status: http.StatusOK, response: EntityInfo{}, handler: srv.getEntity},
+		{method: "GET", path: "/faults", summary: "List faults that can be reverted",
+			status: http.StatusOK, response: []UndoStatus{}, handler: srv.listFaults},
+		{method: "DELETE", path: "/faults", summary: "Revert all the faults, or faults of one entity",
+			query:  map[string]string{"entity_id": "Id of the entity to revert faults of"},
+			status: http.StatusOK, response: RevertResult{}, handler: srv.revertFaults},
+		{method: "GET", path: "/faults/{id}", summary: "Get fault",
+			status: http.StatusOK, response: UndoStatus{}, handler: srv.getFault},
+		{method: "DELETE", path: "/faults/{id}", summary: "Revert fault",
+			status: http.StatusOK, response: RevertResult{}, handler: srv.revertFault},
+		{method: "GET", path: "/events", summary: "List journal events, oldest first",
+			query: map[string]string{
+				"type":      "Type of the events",
+				"task":      "Id of the task events are caused by",
+				"entity_id": "Id of the entity",
+				"since":     "RFC3339 time, only later events are listed",
+				"limit":     "Maximum number of the latest events listed",
+			},
+			status: http.StatusOK, response: []Event{}, handler: srv.listEvents},
+		{method: "GET", path: "/scenarios", summary: "List scenarios",
+			status: http.StatusOK, response: []Scenario{}, handler: srv.listScenarios},
+		{method: "POST", path: "/scenarios", summary: "Add scenario",
+			request: Scenario{}, status: http.StatusCreated, response: Scenario{}, handler: srv.createScenario},
+		{method: "GET", path: "/scenarios/{name}", summary: "Get scenario",
+			status: http.StatusOK, response: Scenario{}, handler: srv.getScenario},
+		{method: "PUT", path: "/scenarios/{name}", summary: "Add or replace scenario",
+			request: Scenario{}, status: http.StatusOK, response: Scenario{}, handler: srv.putScenario},
+		{method: "DELETE", path: "/scenarios/{name}", summary: "Remove scenario",
+			status: http.StatusNoContent, handler: srv.deleteScenario},
+		{method: "POST", path: "/scenarios/{name}/run", summary: "Replace scheduled tasks with scenario's ones and start them",
+			status: http.StatusOK, response: []TaskStatus{}, handler: srv.runScenario},
+		{method: "GET", path: "/capabilities", summary: "List operations playgrounds support",
+			status: http.StatusOK, response: []model.OperationSpec{}, handler: srv.listCapabilities},
+		{method: "GET", path: "/health", summary: "List health of the nodes' APIs playgrounds work through",
+			status: http.StatusOK, response: []model.NodeHealth{}, handler: srv.listHealth},
+		{method: "GET", path: "/version", summary: "Get version of the server",
+			status: http.StatusOK, response: VersionInfo{}, handler: srv.getVersion},
+		{method: "GET", path: "/openapi.json", summary: "Get OpenAPI document of the API",
+			status: http.StatusOK, response: map[string]interface{}{}, handler: srv.getOpenAPI},
+	}
+}
+
+func (ar *apiRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	allowed := make([]string, 0)
+	for i := range ar.routes {
+		params, ok := matchPath(ar.routes[i].path, segments)
+		if !ok {
+			continue
+		}
+		if ar.routes[i].method != r.Method {
+			allowed = append(allowed, ar.routes[i].method)
+			continue
+		}
+		ar.routes[i].handler(w, r, params)
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s is not allowed, use %s", r.Method, strings.Join(allowed, " or ")))
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("No such resource %s", r.URL.Path))
+}
+
+// matchPath matches path segments against pattern,
+// returning values of the pattern's parameters
+func matchPath(pattern string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			value, err := url.PathUnescape(segments[i])
+			if err != nil || value == "" {
+				return nil, false
+			}
+			params[part[1:len(part)-1]] = value
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	respB, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(respB)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	respB, _ := json.Marshal(APIError{Error: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(respB)
+}
+
+// readJSON decodes request body into v, unknown fields are errors
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("Bad request body: %v", err)
+	}
+	return nil
+}
+
+// intParam returns integer path parameter
+func intParam(params map[string]string, name string) (int, error) {
+	i, err := strconv.Atoi(params[name])
+	if err != nil {
+		return 0, fmt.Errorf("Bad %s %q, should be integer", name, params[name])
+	}
+	return i, nil
+}
+
+func (srv *Server) listTasks(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, srv.scheduler.Tasks())
+}
+
+func (srv *Server) createTask(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	spec := TaskSpec{}
+	if err := readJSON(r, &spec); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	glog.Infof("Got create task request %+v.", spec)
+	status, err := srv.scheduler.AddTask(spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/tasks/%d", apiPrefix, status.ID))
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (srv *Server) clearTasks(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	glog.Info("Got clear tasks request.")
+	srv.scheduler.ClearTasks()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) getTask(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	id, err := intParam(params, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	status, err := srv.scheduler.Task(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (srv *Server) deleteTask(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	id, err := intParam(params, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := srv.scheduler.RemoveTask(id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) schedulerState() SchedulerState {
+	state := SchedulerState{Running: srv.scheduler.Running()}
+	for _, task := range srv.scheduler.Tasks() {
+		state.Tasks++
+		if task.Degraded {
+			state.Degraded++
+		}
+	}
+	for _, h := range srv.scheduler.Health() {
+		if !h.Healthy {
+			state.UnhealthyNodes++
+		}
+	}
+	return state
+}
+
+func (srv *Server) getScheduler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, srv.schedulerState())
+}
+
+// putScheduler starts or stops the tasks
+func (srv *Server) putScheduler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	state := SchedulerUpdate{}
+	if err := readJSON(r, &state); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if state.Running && !srv.scheduler.Running() {
+		glog.Info("Got start request.")
+		if err := srv.scheduler.StartTasks(); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	} else if !state.Running {
+		glog.Info("Got stop request.")
+		srv.scheduler.StopTasks()
+	}
+	writeJSON(w, http.StatusOK, srv.schedulerState())
+}
+
+// selectorFromQuery makes selector of the entities query parameters
+func selectorFromQuery(q url.Values) (Selector, error) {
+	selector := Selector{
+		Type:       q.Get("type"),
+		Name:       q.Get("name"),
+		Playground: q.Get("playground"),
+		State:      q.Get("state"),
+	}
+	var err error
+	if selector.Labels, err = parseLabels(q["label"]); err != nil {
+		return selector, err
+	}
+	for _, kv := range q["parent"] {
+		labels, err := parseLabels([]string{kv})
+		if err != nil {
+			return selector, err
+		}
+		selector.Ancestors = append(selector.Ancestors, Selector{Labels: labels})
+	}
+	return selector, selector.Validate()
+}
+
+// parseLabels parses labels in key=value form
+func parseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Bad label %q, should be key=value", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+func (srv *Server) listEntities(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	q := r.URL.Query()
+	selector, err := selectorFromQuery(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	withStatus := false
+	if s := q.Get("status"); s != "" {
+		if withStatus, err = strconv.ParseBool(s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Bad status %q, should be true or false", s))
+			return
+		}
+	}
+	entities, err := srv.scheduler.Entities(r.Context(), selector, withStatus)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entities)
+}
+
+func (srv *Server) getEntity(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	info, err := srv.scheduler.Entity(r.Context(), params["entity_id"])
+	if err == ErrEntityNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (srv *Server) listFaults(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, srv.scheduler.Undos())
+}
+
+func (srv *Server) getFault(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	id, err := intParam(params, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	undo, err := srv.scheduler.Undo(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, undo)
+}
+
+// revertFaults reverts faults of the entity given by
+// entity_id query parameter, or all the faults
+func (srv *Server) revertFaults(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	// reverting shouldn't stop halfway if client goes away
+	ctx := context.Background()
+	var reverted int
+	var err error
+	if entityID := r.URL.Query().Get("entity_id"); entityID != "" {
+		glog.Infof("Got revert request for entity %s.", entityID)
+		reverted, err = srv.scheduler.RevertEntity(ctx, entityID)
+	} else {
+		glog.Info("Got revert all request.")
+		reverted, err = srv.scheduler.RevertAll(ctx)
+	}
+	writeRevertResult(w, reverted, err)
+}
+
+func (srv *Server) revertFault(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	id, err := intParam(params, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	glog.Infof("Got revert request for fault %d.", id)
+	reverted, err := srv.scheduler.RevertUndo(context.Background(), id)
+	writeRevertResult(w, reverted, err)
+}
+
+func writeRevertResult(w http.ResponseWriter, reverted int, err error) {
+	switch {
+	case err == ErrNothingToRevert:
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeJSON(w, http.StatusBadGateway, RevertResult{Reverted: reverted, Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, RevertResult{Reverted: reverted})
+	}
+}
+
+func (srv *Server) listEvents(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	q := r.URL.Query()
+	task := -1
+	if s := q.Get("task"); s != "" {
+		var err error
+		if task, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Bad task %q, should be integer", s))
+			return
+		}
+	}
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Bad since %q, should be RFC3339 time", s))
+			return
+		}
+	}
+	limit := 0
+	if s := q.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Bad limit %q, should be positive integer", s))
+			return
+		}
+	}
+	etype, entityID := EventType(q.Get("type")), q.Get("entity_id")
+	res := make([]Event, 0)
+	for _, e := range srv.scheduler.Journal().Events() {
+		if (etype != "" && e.Type != etype) || (task >= 0 && e.Task != task) ||
+			(entityID != "" && e.EntityID != entityID) || !e.Time.After(since) {
+			continue
+		}
+		res = append(res, e)
+	}
+	if limit > 0 && len(res) > limit {
+		res = res[len(res)-limit:]
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (srv *Server) listScenarios(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, srv.scenarios.list())
+}
+
+func (srv *Server) createScenario(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	scenario := &Scenario{}
+	if err := readJSON(r, scenario); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := srv.scheduler.validateScenario(scenario); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := srv.scenarios.put(scenario, false); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"/scenarios/"+scenario.Name)
+	writeJSON(w, http.StatusCreated, scenario)
+}
+
+func (srv *Server) getScenario(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	scenario, err := srv.scenarios.get(params["name"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, scenario)
+}
+
+// putScenario adds or replaces scenario, name in the body may be omitted
+func (srv *Server) putScenario(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	scenario := &Scenario{}
+	if err := readJSON(r, scenario); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if scenario.Name == "" {
+		scenario.Name = params["name"]
+	}
+	if scenario.Name != params["name"] {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Name %q in the body doesn't match %q", scenario.Name, params["name"]))
+		return
+	}
+	if err := srv.scheduler.validateScenario(scenario); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	added, _ := srv.scenarios.put(scenario, true)
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, scenario)
+}
+
+func (srv *Server) deleteScenario(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := srv.scenarios.remove(params["name"]); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) runScenario(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	scenario, err := srv.scenarios.get(params["name"])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	glog.Infof("Got run scenario %s request.", scenario.Name)
+	tasks, err := srv.scheduler.RunScenario(scenario)
+	if err != nil {
+		// capabilities may have changed since scenario was added
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+func (srv *Server) listCapabilities(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, srv.scheduler.Capabilities())
+}
+
+func (srv *Server) listHealth(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, srv.scheduler.Health())
+}
+
+func (srv *Server) getVersion(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, VersionInfo{
+		Version:  model.SwarmChaosVersion,
+		Compiler: runtime.Compiler,
+		Runtime:  runtime.Version(),
+		ARCH:     runtime.GOARCH,
+		OS:       runtime.GOOS,
+	})
+}
+
+func (srv *Server) getOpenAPI(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	writeJSON(w, http.StatusOK, openAPIDocument(srv.routes()))
+}
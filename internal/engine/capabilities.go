@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// operationValidator is implemented by playgrounds that check
+// operations themselves, like ChaosEngine does for its playgrounds
+type operationValidator interface {
+	validateOperation(op model.Operation, selector *Selector) error
+}
+
+// typesReporter is implemented by playgrounds that tell types of the
+// entities operation can be done on separately for their playgrounds
+type typesReporter interface {
+	supportedTypes(op model.OperationType) map[string]map[model.EntityType]bool
+}
+
+// Capabilities returns operations of all the playgrounds that
+// report them, each spec has name of its playground set
+func (ce *ChaosEngine) Capabilities() []model.OperationSpec {
+	res := make([]model.OperationSpec, 0)
+	for i, playground := range ce.playgrounds {
+		reporter, ok := playground.(model.CapabilityReporter)
+		if !ok {
+			continue
+		}
+		for _, spec := range reporter.Capabilities() {
+			spec.Playground = ce.names[i]
+			res = append(res, spec)
+		}
+	}
+	return res
+}
+
+// supportedTypes returns types of the entities operation can be done on
+// by name of the playground. Playgrounds that don't report capabilities
+// are left out, as the operation may be supported there.
+func (ce *ChaosEngine) supportedTypes(op model.OperationType) map[string]map[model.EntityType]bool {
+	res := make(map[string]map[model.EntityType]bool)
+	for i, playground := range ce.playgrounds {
+		if reporter, ok := playground.(model.CapabilityReporter); ok {
+			res[ce.names[i]] = entityTypes(op, reporter.Capabilities())
+		}
+	}
+	return res
+}
+
+// entityTypes returns types of the entities specs allow operation on
+func entityTypes(op model.OperationType, specs []model.OperationSpec) map[model.EntityType]bool {
+	res := make(map[model.EntityType]bool)
+	for i := range specs {
+		if specs[i].Operation != op {
+			continue
+		}
+		for _, et := range specs[i].Entities {
+			res[et] = true
+		}
+	}
+	return res
+}
+
+// validateOperation checks operation against capabilities of the
+// playgrounds selector may select from. If any of them doesn't report
+// capabilities operation is not checked, as it may be supported there.
+func (ce *ChaosEngine) validateOperation(op model.Operation, selector *Selector) error {
+	specs := make([]model.OperationSpec, 0)
+	found := false
+	for i, playground := range ce.playgrounds {
+		if selector.Playground != "" && selector.Playground != ce.names[i] {
+			continue
+		}
+		found = true
+		reporter, ok := playground.(model.CapabilityReporter)
+		if !ok {
+			return nil
+		}
+		specs = append(specs, reporter.Capabilities()...)
+	}
+	if !found {
+		return fmt.Errorf("Unknown playground %s", selector.Playground)
+	}
+	return validateOperation(op, selector, specs)
+}
+
+// validateOperation checks operation against specs of the
+// entities of the type selector selects
+func validateOperation(op model.Operation, selector *Selector, specs []model.OperationSpec) error {
+	if selector.Type != "" {
+		et, err := model.ParseEntityType(selector.Type)
+		if err != nil {
+			return err
+		}
+		matching := make([]model.OperationSpec, 0, len(specs))
+		for i := range specs {
+			if specs[i].HasEntity(et) {
+				matching = append(matching, specs[i])
+			}
+		}
+		specs = matching
+	}
+	if err := model.ValidateOperation(op, specs); err != nil {
+		if selector.Type != "" {
+			return fmt.Errorf("%v on %s entities", err, selector.Type)
+		}
+		return err
+	}
+	return nil
+}
+
+// validateOperation checks that playground supports operation with
+// its parameters, if playground can tell what it supports
+func (sc *Scheduler) validateOperation(op model.Operation, selector *Selector) error {
+	if validator, ok := sc.playground.(operationValidator); ok {
+		return validator.validateOperation(op, selector)
+	}
+	if reporter, ok := sc.playground.(model.CapabilityReporter); ok {
+		return validateOperation(op, selector, reporter.Capabilities())
+	}
+	return nil
+}
+
+// Capabilities returns operations the playground supports,
+// empty if it can't tell
+func (sc *Scheduler) Capabilities() []model.OperationSpec {
+	if reporter, ok := sc.playground.(model.CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+	return []model.OperationSpec{}
+}
+
+// supporting returns entities operation can be done on, according to
+// capabilities of their playgrounds. Selectors by labels often match
+// tasks or workloads along with their containers, which don't support
+// the same operations. Entities of playgrounds that can't tell what
+// they support are all kept.
+func (sc *Scheduler) supporting(entities []model.Entity, op model.OperationType) []model.Entity {
+	var types map[string]map[model.EntityType]bool
+	if reporter, ok := sc.playground.(typesReporter); ok {
+		types = reporter.supportedTypes(op)
+	} else if reporter, ok := sc.playground.(model.CapabilityReporter); ok {
+		types = map[string]map[model.EntityType]bool{"": entityTypes(op, reporter.Capabilities())}
+	} else {
+		return entities
+	}
+	res := make([]model.Entity, 0, len(entities))
+	for _, e := range entities {
+		playground := ""
+		if pe, ok := e.(*playgroundEntity); ok {
+			playground = pe.Playground()
+		}
+		if supported, ok := types[playground]; !ok || supported[e.Type()] {
+			res = append(res, e)
+		}
+	}
+	return res
+}
@@ -0,0 +1,177 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// BlackholeTargets are destinations made unreachable by the blackhole operation.
+// Each target is host, IP or CIDR with optional TCP port (host:port),
+// 'dns' to make all name resolution fail, or 'dns:name' to make
+// the name resolve to an unreachable address.
+var BlackholeTargets = []string{"dns"}
+
+// embeddedDNS is address of the resolver docker runs in
+// containers of swarm and user-defined networks
+const embeddedDNS = "127.0.0.11"
+
+// hostsMarker ends /etc/hosts lines added by blackhole, followed by id of the fault
+const hostsMarker = "# swarm-chaos blackhole"
+
+// hostnameRe matches host names, they can't start with '-', so
+// they are not taken for options of the commands
+var hostnameRe = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9_])?$`)
+
+// blackholeRules returns iptables rules (without the chain command)
+// that drop traffic to the targets, and names which resolution
+// should be overridden
+func blackholeRules(targets []string) ([]string, []string, error) {
+	rules := make([]string, 0, len(targets))
+	names := make([]string, 0)
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		if target == "dns" {
+			// queries to the embedded resolver of docker are DNATed
+			// to a random port before filter table sees them
+			rules = append(rules,
+				"OUTPUT -p udp --dport 53 -j DROP",
+				"OUTPUT -p tcp --dport 53 -j DROP",
+				"OUTPUT -d "+embeddedDNS+" -p udp -j DROP",
+				"OUTPUT -d "+embeddedDNS+" -p tcp -j DROP",
+			)
+			continue
+		}
+		if strings.HasPrefix(target, "dns:") {
+			name := strings.TrimPrefix(target, "dns:")
+			if !hostnameRe.MatchString(name) {
+				return nil, nil, fmt.Errorf("Bad blackhole target %q, should be dns:hostname", target)
+			}
+			names = append(names, name)
+			continue
+		}
+		host, port := target, ""
+		if h, p, err := net.SplitHostPort(target); err == nil {
+			host, port = h, p
+		}
+		if !isBlackholeHost(host) {
+			return nil, nil, fmt.Errorf("Bad blackhole target %q, should be host, IP or CIDR", target)
+		}
+		if port != "" {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return nil, nil, fmt.Errorf("Bad port of blackhole target %q", target)
+			}
+			rules = append(rules, fmt.Sprintf("OUTPUT -d %s -p tcp --dport %s -j DROP", host, port))
+		} else {
+			rules = append(rules, fmt.Sprintf("OUTPUT -d %s -j DROP", host))
+		}
+	}
+	if len(rules) == 0 && len(names) == 0 {
+		return nil, nil, fmt.Errorf("No blackhole targets specified")
+	}
+	return rules, names, nil
+}
+
+// isBlackholeHost returns true if host is IP, CIDR or host name
+func isBlackholeHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(host); err == nil {
+		return true
+	}
+	return hostnameRe.MatchString(host)
+}
+
+// blackhole makes the targets unreachable from the container for FaultDuration
+func (dc *dockerContainer) blackhole(ctx context.Context, operation model.Operation) error {
+	targets := BlackholeTargets
+	if t := operation.Param(model.ParamTargets.Name, ""); t != "" {
+		targets = strings.Split(t, ",")
+	}
+	rules, names, err := blackholeRules(targets)
+	if err != nil {
+		return err
+	}
+	duration := operation.Duration(model.ParamDuration.Name, FaultDuration)
+	if len(names) > 0 {
+		if err := dc.overrideHosts(ctx, names, duration); err != nil {
+			return err
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	apply := make([]string, 0, len(rules))
+	revert := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		apply = append(apply, "iptables -I "+rule)
+		revert = append(revert, "iptables -D "+rule)
+	}
+	return dc.runNetworkHelper(ctx, duration, strings.Join(apply, "; "), strings.Join(revert, "; "))
+}
+
+// overrideHosts makes names resolve to unroutable addresses in the
+// container for the duration, by adding them to its /etc/hosts.
+// Lines added are marked with id of the fault, so only they are
+// removed when it ends. Names are passed to the script as arguments.
+func (dc *dockerContainer) overrideHosts(ctx context.Context, names []string, duration time.Duration) error {
+	marker := fmt.Sprintf("%s %d", hostsMarker, time.Now().UnixNano())
+	// /etc/hosts is bind mounted, so it is rewritten in place, not replaced.
+	// revert goes to the single-quoted trap, so it has no single quotes.
+	revert := fmt.Sprintf(`h=$(grep -v " %s$" /etc/hosts); echo "$h" > /etc/hosts`, marker)
+	apply := fmt.Sprintf(`for n in "$@"; do printf '0.0.0.0 %%s %s\n:: %%s %s\n' "$n" "$n" >> /etc/hosts || exit 1; done`, marker, marker)
+	script := fmt.Sprintf(`trap '%s; exit 0' TERM INT; %s; sleep %d & wait; %s`,
+		revert, apply, int(duration.Seconds()), revert)
+	cmd := append([]string{"sh", "-c", script, "sh"}, names...)
+	if err := dc.execDetached(ctx, cmd...); err != nil {
+		return err
+	}
+	dc.dp.mu.Lock()
+	dc.dp.overriddenHosts[dc.container.ID] = true
+	dc.dp.mu.Unlock()
+	time.AfterFunc(duration, func() {
+		dc.dp.mu.Lock()
+		delete(dc.dp.overriddenHosts, dc.container.ID)
+		dc.dp.mu.Unlock()
+	})
+	return nil
+}
+
+// hasOverriddenHosts returns true if names are blackholed in the container
+func (dc *dockerContainer) hasOverriddenHosts() bool {
+	dc.dp.mu.Lock()
+	defer dc.dp.mu.Unlock()
+	return dc.dp.overriddenHosts[dc.container.ID]
+}
+
+// restoreHosts removes all the lines added by blackhole from
+// the container's /etc/hosts before the faults end
+func (dc *dockerContainer) restoreHosts(ctx context.Context) error {
+	dc.dp.mu.Lock()
+	has := dc.dp.overriddenHosts[dc.container.ID]
+	delete(dc.dp.overriddenHosts, dc.container.ID)
+	dc.dp.mu.Unlock()
+	if !has {
+		return nil
+	}
+	_, err := dc.exec(ctx, "sh", "-c", fmt.Sprintf(`h=$(grep -v ' %s [0-9]*$' /etc/hosts); echo "$h" > /etc/hosts`, hostsMarker))
+	return err
+}
+
+// unblackhole reverts all the network faults and host overrides of the container
+func (dc *dockerContainer) unblackhole(ctx context.Context) error {
+	if err := dc.stopNetworkHelpers(ctx); err != nil {
+		return err
+	}
+	return dc.restoreHosts(ctx)
+}
@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlackholeRules(t *testing.T) {
+	tests := []struct {
+		targets   []string
+		wantRules []string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			targets: []string{"dns"},
+			wantRules: []string{
+				"OUTPUT -p udp --dport 53 -j DROP",
+				"OUTPUT -p tcp --dport 53 -j DROP",
+				"OUTPUT -d 127.0.0.11 -p udp -j DROP",
+				"OUTPUT -d 127.0.0.11 -p tcp -j DROP",
+			},
+		},
+		{targets: []string{"dns:db", " 10.0.0.0/8", ""}, wantRules: []string{"OUTPUT -d 10.0.0.0/8 -j DROP"}, wantNames: []string{"db"}},
+		{targets: []string{"db:5432"}, wantRules: []string{"OUTPUT -d db -p tcp --dport 5432 -j DROP"}},
+		{targets: []string{"db:0"}, wantErr: true},
+		{targets: []string{"-j ACCEPT"}, wantErr: true},
+		{targets: []string{"dns:-x"}, wantErr: true},
+		{targets: []string{""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		rules, names, err := blackholeRules(tt.targets)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, want error %v", tt.targets, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(rules, "\n") != strings.Join(tt.wantRules, "\n") {
+			t.Errorf("%q: rules %q, want %q", tt.targets, rules, tt.wantRules)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+			t.Errorf("%q: names %q, want %q", tt.targets, names, tt.wantNames)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// ClockSkewConfig configures clock skew operation.
+	//
+	// Time of the running process can't be changed from outside,
+	// time namespaces only shift monotonic clocks of new processes,
+	// so skew relies on libfaketime. Target containers should already
+	// run their processes with libfaketime preloaded, skew has no
+	// effect otherwise:
+	//   LD_PRELOAD=/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1
+	//   FAKETIME_TIMESTAMP_FILE=<File>
+	//   FAKETIME_NO_CACHE=1
+	// and skew operation changes offset written in the File.
+	ClockSkewConfig struct {
+		// Offset time is shifted by, can be negative
+		Offset time.Duration
+		// File read by libfaketime inside the container
+		File string
+	}
+
+	// clockSkew is skew applied to the container's faketime file
+	clockSkew struct {
+		file string
+		// value written by the skew
+		value string
+		// original content of the file, if it existed
+		original string
+		existed  bool
+	}
+)
+
+// ClockSkew is used by the skew_clock operation
+var ClockSkew = ClockSkewConfig{
+	Offset: time.Hour,
+	File:   "/etc/faketimerc",
+}
+
+// restoreFaketime is shell function restoring faketime file $1
+// to content $3 if it still holds value $2 written by the skew, or
+// removing the file if $4 is empty, as it didn't exist before.
+// Skews applied later are kept.
+const restoreFaketime = `restore() { if [ "$(cat "$1" 2>/dev/null)" = "$2" ]; then if [ -n "$4" ]; then printf '%s\n' "$3" > "$1"; else rm -f "$1"; fi; fi; }`
+
+// faketimeOffset formats offset as libfaketime's relative time
+func faketimeOffset(offset time.Duration) string {
+	return fmt.Sprintf("%+d", int64(offset.Seconds()))
+}
+
+// args returns arguments of the restore function
+func (cs *clockSkew) args() []string {
+	existed := ""
+	if cs.existed {
+		existed = "1"
+	}
+	return []string{cs.file, cs.value, cs.original, existed}
+}
+
+// skewClock shifts time seen by the container's processes for FaultDuration,
+// offset and duration can be set by the operation's parameters
+func (dc *dockerContainer) skewClock(ctx context.Context, operation model.Operation) error {
+	duration := operation.Duration(model.ParamDuration.Name, FaultDuration)
+	offset := operation.Duration(model.ParamOffset.Name, ClockSkew.Offset)
+	skew := &clockSkew{
+		file:  ClockSkew.File,
+		value: faketimeOffset(offset),
+	}
+	dc.dp.mu.Lock()
+	prev, skewed := dc.dp.skewedClocks[dc.container.ID]
+	dc.dp.mu.Unlock()
+	if skewed && prev.file == skew.file {
+		// file holds previous skew, its original content is restored
+		skew.original, skew.existed = prev.original, prev.existed
+	} else {
+		out, err := dc.exec(ctx, "sh", "-c", `if [ -e "$1" ]; then printf x; cat "$1"; fi`, "sh", skew.file)
+		if err != nil {
+			return err
+		}
+		skew.existed = strings.HasPrefix(out, "x")
+		skew.original = strings.TrimRight(strings.TrimPrefix(out, "x"), "\n")
+	}
+	script := fmt.Sprintf(`%s; trap 'restore "$@"; exit 0' TERM INT; printf '%%s\n' "$2" > "$1" || exit 1; sleep %d & wait; restore "$@"`,
+		restoreFaketime, int(duration.Seconds()))
+	cmd := append([]string{"sh", "-c", script, "sh"}, skew.args()...)
+	if err := dc.execDetached(ctx, cmd...); err != nil {
+		return err
+	}
+	dc.dp.mu.Lock()
+	dc.dp.skewedClocks[dc.container.ID] = skew
+	dc.dp.mu.Unlock()
+	time.AfterFunc(duration, func() {
+		dc.dp.mu.Lock()
+		if dc.dp.skewedClocks[dc.container.ID] == skew {
+			delete(dc.dp.skewedClocks, dc.container.ID)
+		}
+		dc.dp.mu.Unlock()
+	})
+	return nil
+}
+
+// hasClockSkew returns true if clock of the container is skewed
+func (dc *dockerContainer) hasClockSkew() bool {
+	dc.dp.mu.Lock()
+	defer dc.dp.mu.Unlock()
+	_, has := dc.dp.skewedClocks[dc.container.ID]
+	return has
+}
+
+// resetClock removes clock skew before FaultDuration ends,
+// restoring original content of the faketime file
+func (dc *dockerContainer) resetClock(ctx context.Context) error {
+	dc.dp.mu.Lock()
+	skew, has := dc.dp.skewedClocks[dc.container.ID]
+	delete(dc.dp.skewedClocks, dc.container.ID)
+	dc.dp.mu.Unlock()
+	if !has {
+		return nil
+	}
+	cmd := append([]string{"sh", "-c", restoreFaketime + `; restore "$@"`, "sh"}, skew.args()...)
+	_, err := dc.exec(ctx, cmd...)
+	return err
+}
@@ -3,8 +3,8 @@ package docker
 import (
 	"context"
 	"crypto/tls"
-	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -20,19 +20,61 @@ var AgentHost = "tcp://localhost:9001"
 type (
 	DockerPlayground struct {
 		client *client.Client
-		nodes  []swarm.Node
+		// agentHost is url of the agent of the swarm
+		agentHost string
+		// pool keeps clients of the swarm nodes
+		pool *clientPool
+		// nodes, services and tasks of the swarm
+		cluster swarmCache
+		mu      sync.Mutex
+		// availability of the nodes before they were drained or paused
+		savedAvailability map[string]swarm.NodeAvailability
+		// resource limits of the slowed down containers
+		savedResources map[string]slowedResources
+		// sidecars injecting network faults, keyed by container id
+		networkHelpers map[string][]string
+		// containers with names blackholed in /etc/hosts
+		overriddenHosts map[string]bool
+		// skews of the containers' clocks
+		skewedClocks map[string]*clockSkew
+		cache        containerCache
+		listeners    []func(model.StatusChange)
+		// cancel stops watching events
+		cancel context.CancelFunc
 	}
 
 	dockerContainer struct {
 		container types.Container
 		dp        *DockerPlayground
-		client    *client.Client
+		parent    model.Entity
+		processes []model.Entity
 	}
 )
 
-var operationTimeout = 2 * time.Second
+// StopTimeout is how long container has to stop gracefully before it is killed
+var StopTimeout = 2 * time.Second
 
-func newPortainerAgentClient(host string, nodeName string) (*client.Client, error) {
+// HTTPTimeout limits requests to the agent, except events streams.
+// It should be longer than StopTimeout.
+var HTTPTimeout = 5 * time.Second
+
+// FaultDuration is how long bounded faults (stress, slowdown, network faults, clock skew) last
+var FaultDuration = time.Minute
+
+// GracefulDestroy makes destroy operation stop container
+// before removing it, instead of removing it forcibly
+var GracefulDestroy = false
+
+const (
+	swarmNodeIDLabel      = "com.docker.swarm.node.id"
+	swarmTaskIDLabel      = "com.docker.swarm.task.id"
+	swarmServiceIDLabel   = "com.docker.swarm.service.id"
+	swarmServiceNameLabel = "com.docker.swarm.service.name"
+)
+
+// newPortainerAgentClient creates client of the node reached through the agent,
+// report is called with result of every request if it is not nil
+func newPortainerAgentClient(host string, nodeName string, timeout time.Duration, report func(error)) (*client.Client, *http.Transport, error) {
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: true,
 	}
@@ -41,7 +83,10 @@ func newPortainerAgentClient(host string, nodeName string) (*client.Client, erro
 	}
 	httpCli := &http.Client{
 		Transport: transport,
-		Timeout:   5 * time.Second,
+		Timeout:   timeout,
+	}
+	if report != nil {
+		httpCli.Transport = &healthTransport{next: transport, report: report}
 	}
 
 	headers := map[string]string{
@@ -52,46 +97,140 @@ func newPortainerAgentClient(host string, nodeName string) (*client.Client, erro
 	if nodeName != "" {
 		headers["X-PortainerAgent-Target"] = nodeName
 	}
-	fmt.Printf("Using headers: %+v\n", headers)
+	glog.V(2).Infof("Using headers: %+v", headers)
 
-	return client.NewClientWithOpts(
+	cli, err := client.NewClientWithOpts(
 		client.WithHost(host),
 		client.WithHTTPClient(httpCli),
 		client.WithHTTPHeaders(headers),
+		// can't be detected from wrapped transport
+		client.WithScheme("https"),
+		client.WithAPIVersionNegotiation(),
 	)
+	return cli, transport, err
 }
 
 // NewDockerPlayground creates a new docker driver
+// working through the agent at AgentHost
 func NewDockerPlayground() (*DockerPlayground, error) {
-	ctx := context.Background()
+	return NewDockerPlaygroundForAgent(AgentHost)
+}
+
+// NewDockerPlaygroundForAgent creates a new docker driver working
+// through the agent at agentHost, so several swarms can be used at once.
+// Driver watches docker events to keep containers list up to date,
+// Close should be called to stop it.
+func NewDockerPlaygroundForAgent(agentHost string) (*DockerPlayground, error) {
 	// cli, err := client.NewClientWithOpts(client.FromEnv)
-	cli, err := newPortainerAgentClient(AgentHost, "")
+	pool := newClientPool(agentHost)
+	cli, err := pool.get("")
 	if err != nil {
 		return nil, err
 	}
-	cli.NegotiateAPIVersion(ctx)
 	dp := &DockerPlayground{
-		client: cli,
+		client:            cli,
+		agentHost:         agentHost,
+		pool:              pool,
+		savedAvailability: make(map[string]swarm.NodeAvailability),
+		savedResources:    make(map[string]slowedResources),
+		networkHelpers:    make(map[string][]string),
+		overriddenHosts:   make(map[string]bool),
+		skewedClocks:      make(map[string]*clockSkew),
+		cache: containerCache{
+			containers: make(map[string]types.Container),
+			watched:    make(map[string]bool),
+		},
 	}
-	dp.refreshNodes()
+	dp.refreshSwarm(true)
+	watchCtx, cancel := context.WithCancel(context.Background())
+	dp.cancel = cancel
+	go dp.watch(watchCtx)
 
 	return dp, nil
 }
 
-// Entities returns a list of all the entities
+// Capabilities returns operations the driver can do and their parameters
+func (dp *DockerPlayground) Capabilities() []model.OperationSpec {
+	container := []model.EntityType{model.EntityTypeContainer}
+	process := []model.EntityType{model.EntityTypeProcess}
+	both := []model.EntityType{model.EntityTypeContainer, model.EntityTypeProcess}
+	node := []model.EntityType{model.EntityTypeVM}
+	all := []model.EntityType{model.EntityTypeContainer, model.EntityTypeProcess, model.EntityTypeVM}
+	return []model.OperationSpec{
+		{Operation: model.OperationTypeDestroy, Entities: container, Params: []model.ParamSpec{model.ParamTimeout}},
+		{Operation: model.OperationTypeDestroy, Entities: process},
+		{Operation: model.OperationTypeStop, Entities: container, Params: []model.ParamSpec{model.ParamTimeout}},
+		{Operation: model.OperationTypeStop, Entities: process},
+		{Operation: model.OperationTypeRestart, Entities: container, Params: []model.ParamSpec{model.ParamTimeout}},
+		{Operation: model.OperationTypeStart, Entities: container},
+		{Operation: model.OperationTypeKill, Entities: both, Params: []model.ParamSpec{model.ParamSignal}},
+		{Operation: model.OperationTypePause, Entities: all},
+		{Operation: model.OperationTypeResume, Entities: all},
+		{Operation: model.OperationTypeDrain, Entities: node},
+		{Operation: model.OperationTypeSlowdown, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamCPUs, model.ParamMemory}},
+		{Operation: model.OperationTypeStressCPU, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamCPUs}},
+		{Operation: model.OperationTypeStressMemory, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamMemory}},
+		{Operation: model.OperationTypeStressDisk, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamDisk}},
+		{Operation: model.OperationTypeBlackhole, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamTargets}},
+		{Operation: model.OperationTypeThrottle, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamRate}},
+		{Operation: model.OperationTypeSkewClock, Entities: container, Params: []model.ParamSpec{model.ParamDuration, model.ParamOffset}},
+	}
+}
+
+// Entities returns a list of all the entities:
+// swarm nodes, service tasks and containers.
+// Containers are served from the cache kept by docker events.
 func (dp *DockerPlayground) Entities() ([]model.Entity, error) {
+	return dp.Query(model.Query{})
+}
+
+// Query returns entities selected by the query. Containers are
+// filtered in the cache, or by docker if cache is not valid.
+// Nodes and tasks, containers' ancestors, come from the swarm cache.
+func (dp *DockerPlayground) Query(q model.Query) ([]model.Entity, error) {
 	res := make([]model.Entity, 0)
-	containers, err := dp.client.ContainerList(context.Background(), types.ContainerListOptions{All: true})
-	if err != nil {
-		return nil, err
+	ctx := context.Background()
+	var containers []types.Container
+	if q.HasType(model.EntityTypeContainer) || q.HasType(model.EntityTypeProcess) {
+		var err error
+		if containers, err = dp.listContainers(ctx, &q); err != nil {
+			return nil, err
+		}
+	}
+	dp.refreshSwarm(false)
+	nodes := make(map[string]*dockerNode)
+	for _, node := range dp.getNodes() {
+		dn := &dockerNode{
+			node: node,
+			dp:   dp,
+		}
+		nodes[node.ID] = dn
+		if q.HasType(model.EntityTypeVM) && (!q.Running || isNodeWorking(node)) {
+			res = append(res, dn)
+		}
+	}
+	tasks := dp.swarmTasks(nodes)
+	if q.HasType(model.EntityTypeTask) {
+		for _, dt := range tasks {
+			res = append(res, dt)
+		}
 	}
 	for _, container := range containers {
+		if _, isHelper := container.Labels[helperLabel]; isHelper {
+			continue
+		}
 		// fmt.Printf("Got container info ---------------------------:\n")
 		// fmt.Printf("%+v\n", container)
 		dc := &dockerContainer{
 			container: container,
 			dp:        dp,
-			// client:    dp.client,
+		}
+		if dt, has := tasks[container.Labels[swarmTaskIDLabel]]; has {
+			dc.parent = dt
+			dt.childs = append(dt.childs, dc)
+		} else if dn, has := nodes[container.Labels[swarmNodeIDLabel]]; has {
+			dc.parent = dn
+			dn.childs = append(dn.childs, dc)
 		}
 		res = append(res, dc)
 	}
@@ -99,29 +238,16 @@ func (dp *DockerPlayground) Entities() ([]model.Entity, error) {
 	return res, nil
 }
 
-func (dp *DockerPlayground) refreshNodes() {
-	ctx := context.Background()
-	nodes, err := dp.client.NodeList(ctx, types.NodeListOptions{})
-	if err != nil {
-		glog.Infof("Error getting nodes list: %v", err)
-		return
-	}
-	dp.nodes = nodes
-	for _, node := range dp.nodes {
-		glog.Infof("Node %s has id %s\n", node.Description.Hostname, node.ID)
-	}
-}
-
 func (dp *DockerPlayground) getNodeNameFromLabels(labels map[string]string) string {
 	// glog.Infof("get node name form labels: %+v\n", labels)
 	// glog.Infof("nodes list: %+v\n", dp.nodes)
 	// glog.Infof("nodes number %d\n", len(dp.nodes))
-	if len(dp.nodes) == 0 {
-		dp.refreshNodes()
+	if len(dp.getNodes()) == 0 {
+		dp.refreshSwarm(false)
 	}
-	if id, has := labels["com.docker.swarm.node.id"]; has {
+	if id, has := labels[swarmNodeIDLabel]; has {
 		glog.Infof("node id: %s, has: %v\n", id, has)
-		for _, node := range dp.nodes {
+		for _, node := range dp.getNodes() {
 			if node.ID == id {
 				return node.Description.Hostname
 			}
@@ -130,6 +256,10 @@ func (dp *DockerPlayground) getNodeNameFromLabels(labels map[string]string) stri
 	return ""
 }
 
+func (dc *dockerContainer) ID() string {
+	return dc.container.ID
+}
+
 func (dc *dockerContainer) Name() string {
 	name := dc.container.ID
 	if len(dc.container.Names) > 0 {
@@ -144,46 +274,119 @@ func (dc *dockerContainer) Labels() map[string]string {
 	return dc.container.Labels
 }
 
+func (dc *dockerContainer) Parent() model.Entity {
+	return dc.parent
+}
+
+// Childs returns processes running inside the container,
+// discovering them on the first call
 func (dc *dockerContainer) Childs() []model.Entity {
-	return nil
+	if dc.processes != nil || dc.container.State != "running" {
+		return dc.processes
+	}
+	processes, err := dc.listProcesses(context.Background())
+	if err != nil {
+		glog.Infof("Error listing processes of container %s: %v", dc.Name(), err)
+		return nil
+	}
+	dc.processes = make([]model.Entity, 0, len(processes))
+	for _, p := range processes {
+		dc.processes = append(dc.processes, p)
+	}
+	return dc.processes
 }
 
 func (dc *dockerContainer) Type() model.EntityType {
 	return model.EntityTypeContainer
 }
 
-func (dc *dockerContainer) Do(operation model.OperationType) error {
-	client := dc.getClient()
-	switch operation {
+func (dc *dockerContainer) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(dc.do(ctx, operation))
+}
+
+func (dc *dockerContainer) do(ctx context.Context, operation model.Operation) error {
+	client, err := dc.getClient()
+	if err != nil {
+		return err
+	}
+	switch operation.Type {
 	case model.OperationTypeDestroy:
-		err := client.ContainerRemove(context.Background(), dc.container.ID, types.ContainerRemoveOptions{Force: true})
+		if GracefulDestroy {
+			timeout := operation.Duration(model.ParamTimeout.Name, StopTimeout)
+			err := client.ContainerStop(ctx, dc.container.ID, &timeout)
+			if err != nil {
+				return err
+			}
+		}
+		err := client.ContainerRemove(ctx, dc.container.ID, types.ContainerRemoveOptions{Force: true})
 		return err
 	case model.OperationTypePause:
-		err := client.ContainerPause(context.Background(), dc.container.ID)
+		err := client.ContainerPause(ctx, dc.container.ID)
 		return err
 	case model.OperationTypeResume:
-		err := client.ContainerUnpause(context.Background(), dc.container.ID)
+		// resume reverts injected faults, or unpauses container if there are none
+		if dc.hasNetworkHelpers() || dc.hasOverriddenHosts() || dc.isSlowedDown() || dc.hasClockSkew() {
+			if err := dc.unblackhole(ctx); err != nil {
+				return err
+			}
+			if err := dc.resetClock(ctx); err != nil {
+				return err
+			}
+			return dc.restoreResources(ctx)
+		}
+		err := client.ContainerUnpause(ctx, dc.container.ID)
 		return err
+	case model.OperationTypeSlowdown:
+		return dc.slowdown(ctx, operation)
+	case model.OperationTypeBlackhole:
+		return dc.blackhole(ctx, operation)
+	case model.OperationTypeThrottle:
+		return dc.throttle(ctx, operation)
+	case model.OperationTypeSkewClock:
+		return dc.skewClock(ctx, operation)
 	case model.OperationTypeStop:
-		err := client.ContainerStop(context.Background(), dc.container.ID, &operationTimeout)
+		timeout := operation.Duration(model.ParamTimeout.Name, StopTimeout)
+		err := client.ContainerStop(ctx, dc.container.ID, &timeout)
 		return err
 	case model.OperationTypeStart:
-		err := client.ContainerStart(context.Background(), dc.container.ID, types.ContainerStartOptions{})
+		err := client.ContainerStart(ctx, dc.container.ID, types.ContainerStartOptions{})
+		return err
+	case model.OperationTypeKill:
+		err := client.ContainerKill(ctx, dc.container.ID, operation.Param(model.ParamSignal.Name, KillSignal))
 		return err
+	case model.OperationTypeRestart:
+		timeout := operation.Duration(model.ParamTimeout.Name, StopTimeout)
+		err := client.ContainerRestart(ctx, dc.container.ID, &timeout)
+		return err
+	case model.OperationTypeStressCPU, model.OperationTypeStressMemory, model.OperationTypeStressDisk:
+		return dc.stress(ctx, operation)
 	}
-	return nil
+	return model.ErrOperationNotSupported
+}
+
+func (dc *dockerContainer) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := dc.status(ctx)
+	return status, classifyError(err)
 }
 
-func (dc *dockerContainer) Status() (model.StatusType, error) {
+func (dc *dockerContainer) status(ctx context.Context) (model.StatusType, error) {
 	// dc.container.Status
-	client := dc.getClient()
-	j, err := client.ContainerInspect(context.Background(), dc.container.ID)
+	client, err := dc.getClient()
+	if err != nil {
+		return 0, err
+	}
+	j, err := client.ContainerInspect(ctx, dc.container.ID)
 	if err != nil {
 		return 0, err
 	}
 	// Status     string // String representation of the container state. Can be one of "created", "running", "paused", "restarting", "removing", "exited", or "dead"
 	switch j.State.Status {
-	case "created", "running", "restarting":
+	case "running":
+		if dc.isSlowedDown() {
+			return model.StatusTypeSlow, nil
+		}
+		return model.StatusTypeWorking, nil
+	case "created", "restarting":
 		return model.StatusTypeWorking, nil
 	case "paused":
 		return model.StatusTypePaused, nil
@@ -193,21 +396,9 @@ func (dc *dockerContainer) Status() (model.StatusType, error) {
 	return model.StatusTypeWorking, nil
 }
 
-func (dc *dockerContainer) getClient() *client.Client {
-	if dc.client != nil {
-		return dc.client
-	}
+// getClient returns pooled client of the container's node
+func (dc *dockerContainer) getClient() (*client.Client, error) {
 	nodeName := dc.dp.getNodeNameFromLabels(dc.container.Labels)
-	glog.Infof("Got node name from labels: %s\n", nodeName)
-	if nodeName == "" {
-		dc.client = dc.dp.client
-	} else {
-		cli, err := newPortainerAgentClient(AgentHost, nodeName)
-		if err != nil {
-			panic(err)
-		}
-		cli.NegotiateAPIVersion(context.Background())
-		dc.client = cli
-	}
-	return dc.client
+	glog.V(2).Infof("Got node name from labels: %s", nodeName)
+	return dc.dp.pool.get(nodeName)
 }
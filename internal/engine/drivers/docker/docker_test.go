@@ -0,0 +1,479 @@
+package docker
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/docker/fakeagent"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// newTestPlayground returns playground working through fake agent of
+// swarm of nodes node1 and node2, running service web of two tasks,
+// one on each node, and standalone container db on node2. Returned
+// function stops both.
+func newTestPlayground(t *testing.T) (*DockerPlayground, *fakeagent.FakeAgent, func()) {
+	t.Helper()
+	fa := fakeagent.NewFakeAgent()
+	fa.AddNode("n1", "node1")
+	fa.AddNode("n2", "node2")
+	fa.AddService("s1", "web")
+	fa.AddTask("t1", "s1", "n1", 1)
+	fa.AddTask("t2", "s1", "n2", 2)
+	for _, c := range []struct{ id, name, node, task string }{
+		{"c1", "web.1.t1", "n1", "t1"},
+		{"c2", "web.2.t2", "n2", "t2"},
+		{"c3", "db", "n2", ""},
+	} {
+		labels := map[string]string{"app": strings.Split(c.name, ".")[0]}
+		if err := fa.AddContainer(c.id, c.name, c.node, c.task, labels); err != nil {
+			fa.Close()
+			t.Fatal(err)
+		}
+	}
+	dp, err := NewDockerPlaygroundForAgent(fa.Host())
+	if err != nil {
+		fa.Close()
+		t.Fatal(err)
+	}
+	return dp, fa, func() {
+		dp.Close()
+		fa.Close()
+	}
+}
+
+// waitWatched waits till events of all the nodes are watched
+func waitWatched(t *testing.T, dp *DockerPlayground) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		dp.mu.Lock()
+		watched := len(dp.cache.watched) == 2
+		for _, connected := range dp.cache.watched {
+			watched = watched && connected
+		}
+		dp.mu.Unlock()
+		if watched {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Events of the nodes are not watched")
+}
+
+// entity returns entity with the name
+func entity(t *testing.T, dp *DockerPlayground, name string) model.Entity {
+	t.Helper()
+	entities, err := dp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if e.Name() == name {
+			return e
+		}
+	}
+	t.Fatalf("No entity %s", name)
+	return nil
+}
+
+// hasEntity returns true if entity with the name is listed
+func hasEntity(dp *DockerPlayground, name string) bool {
+	entities, _ := dp.Entities()
+	for _, e := range entities {
+		if e.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkViolations fails test if agent got requests
+// without signature or routed to the wrong node
+func checkViolations(t *testing.T, fa *fakeagent.FakeAgent) {
+	t.Helper()
+	for _, v := range fa.Violations() {
+		t.Error(v)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	dp, fa, stop := newTestPlayground(t)
+	defer stop()
+	tests := []struct {
+		name   string
+		etype  model.EntityType
+		parent string
+		childs int
+	}{
+		{name: "node1", etype: model.EntityTypeVM, childs: 1},
+		{name: "node2", etype: model.EntityTypeVM, childs: 2},
+		{name: "web.1", etype: model.EntityTypeTask, parent: "node1", childs: 1},
+		{name: "web.2", etype: model.EntityTypeTask, parent: "node2", childs: 1},
+		{name: "/web.1.t1", etype: model.EntityTypeContainer, parent: "web.1"},
+		{name: "/web.2.t2", etype: model.EntityTypeContainer, parent: "web.2"},
+		{name: "/db", etype: model.EntityTypeContainer, parent: "node2"},
+	}
+	entities, err := dp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != len(tests) {
+		t.Errorf("Got %d entities, want %d", len(entities), len(tests))
+	}
+	for _, tt := range tests {
+		e := entity(t, dp, tt.name)
+		if e.Type() != tt.etype {
+			t.Errorf("Type of %s = %s, want %s", tt.name, e.Type(), tt.etype)
+		}
+		parent := ""
+		if e.Parent() != nil {
+			parent = e.Parent().Name()
+		}
+		if parent != tt.parent {
+			t.Errorf("Parent of %s = %q, want %q", tt.name, parent, tt.parent)
+		}
+		if e.Type() != model.EntityTypeContainer && len(e.Childs()) != tt.childs {
+			t.Errorf("%s has %d childs, want %d", tt.name, len(e.Childs()), tt.childs)
+		}
+	}
+	checkViolations(t, fa)
+}
+
+func TestQuery(t *testing.T) {
+	dp, fa, stop := newTestPlayground(t)
+	defer stop()
+	container := []model.EntityType{model.EntityTypeContainer}
+	tests := []struct {
+		name string
+		q    model.Query
+		want []string
+	}{
+		{name: "label", q: model.Query{Types: container, Labels: map[string]string{"app": "web"}}, want: []string{"/web.1.t1", "/web.2.t2"}},
+		{name: "name", q: model.Query{Types: container, Name: "/db"}, want: []string{"/db"}},
+		{name: "glob", q: model.Query{Types: container, Name: "/web.*.t2"}, want: []string{"/web.2.t2"}},
+		{name: "vms", q: model.Query{Types: []model.EntityType{model.EntityTypeVM}}, want: []string{"node1", "node2"}},
+		{name: "tasks", q: model.Query{Types: []model.EntityType{model.EntityTypeTask}}, want: []string{"web.1", "web.2"}},
+	}
+	run := func(when string) {
+		for _, tt := range tests {
+			entities, err := dp.Query(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(entities))
+			for _, e := range entities {
+				got = append(got, e.Name())
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%s, %s: got %v, want %v", when, tt.name, got, tt.want)
+			}
+		}
+	}
+	// docker filters are used till events are watched, then the cache
+	run("listed")
+	waitWatched(t, dp)
+	run("cached")
+	checkViolations(t, fa)
+}
+
+func TestContainerOperations(t *testing.T) {
+	tests := []struct {
+		container string
+		id        string
+		op        model.Operation
+		// state of the container in agent, empty if it is removed
+		state  string
+		status model.StatusType
+		// state after undo, empty if operation can't be undone
+		undoState string
+	}{
+		{container: "/db", id: "c3", op: model.NewOperation(model.OperationTypePause), state: "paused", status: model.StatusTypePaused, undoState: "running"},
+		{container: "/web.1.t1", id: "c1", op: model.NewOperation(model.OperationTypePause), state: "paused", status: model.StatusTypePaused, undoState: "running"},
+		{container: "/web.2.t2", id: "c2", op: model.NewOperation(model.OperationTypeStop), state: "exited", status: model.StatusTypeDestroyed},
+		{container: "/db", id: "c3", op: model.NewOperation(model.OperationTypeKill), state: "exited", status: model.StatusTypeDestroyed},
+		{container: "/db", id: "c3", op: model.NewOperation(model.OperationTypeRestart), state: "running", status: model.StatusTypeWorking},
+		{container: "/db", id: "c3", op: model.NewOperation(model.OperationTypeDestroy)},
+	}
+	for _, tt := range tests {
+		dp, fa, stop := newTestPlayground(t)
+		ctx := context.Background()
+		e := entity(t, dp, tt.container)
+		undo, err := e.(model.Reversible).DoReversible(ctx, tt.op)
+		if err != nil {
+			t.Errorf("%s of %s: %v", tt.op, tt.container, err)
+			stop()
+			continue
+		}
+		state, exists := fa.ContainerState(tt.id)
+		if state != tt.state || exists != (tt.state != "") {
+			t.Errorf("%s of %s: container state %q, want %q", tt.op, tt.container, state, tt.state)
+		}
+		status, err := e.Status(ctx)
+		if tt.state == "" {
+			if model.ClassifyError(err) != model.ErrorClassGone {
+				t.Errorf("Status of %s after %s: %v, want gone error", tt.container, tt.op, err)
+			}
+		} else if err != nil || status != tt.status {
+			t.Errorf("Status of %s after %s = %s, %v, want %s", tt.container, tt.op, status, err, tt.status)
+		}
+		if (undo != nil) != (tt.undoState != "") {
+			t.Errorf("%s of %s: undo %v, want undo %v", tt.op, tt.container, undo, tt.undoState != "")
+		} else if undo != nil {
+			if err := undo.Undo(ctx); err != nil {
+				t.Errorf("Undo of %s of %s: %v", tt.op, tt.container, err)
+			}
+			if state, _ := fa.ContainerState(tt.id); state != tt.undoState {
+				t.Errorf("Undo of %s of %s: container state %q, want %q", tt.op, tt.container, state, tt.undoState)
+			}
+		}
+		checkViolations(t, fa)
+		stop()
+	}
+}
+
+func TestNodeOperations(t *testing.T) {
+	tests := []struct {
+		op           model.OperationType
+		availability swarm.NodeAvailability
+		status       model.StatusType
+	}{
+		{op: model.OperationTypePause, availability: swarm.NodeAvailabilityPause, status: model.StatusTypePaused},
+		{op: model.OperationTypeDrain, availability: swarm.NodeAvailabilityDrain, status: model.StatusTypeStopped},
+	}
+	for _, tt := range tests {
+		dp, fa, stop := newTestPlayground(t)
+		ctx := context.Background()
+		dn := entity(t, dp, "node2")
+		undo, err := dn.(model.Reversible).DoReversible(ctx, model.NewOperation(tt.op))
+		if err != nil {
+			t.Errorf("%s: %v", tt.op, err)
+			stop()
+			continue
+		}
+		if availability := fa.NodeAvailability("n2"); availability != tt.availability {
+			t.Errorf("Availability after %s = %s, want %s", tt.op, availability, tt.availability)
+		}
+		if status, _ := dn.Status(ctx); status != tt.status {
+			t.Errorf("Status after %s = %s, want %s", tt.op, status, tt.status)
+		}
+		if err := undo.Undo(ctx); err != nil {
+			t.Errorf("Undo of %s: %v", tt.op, err)
+		}
+		if availability := fa.NodeAvailability("n2"); availability != swarm.NodeAvailabilityActive {
+			t.Errorf("Availability after undo of %s = %s", tt.op, availability)
+		}
+		checkViolations(t, fa)
+		stop()
+	}
+}
+
+// TestEvents checks that status changes are reported and cache
+// is kept up to date by the events of the containers' nodes
+func TestEvents(t *testing.T) {
+	dp, fa, stop := newTestPlayground(t)
+	defer stop()
+	changes := make(chan model.StatusChange, 10)
+	dp.NotifyStatus(func(change model.StatusChange) {
+		changes <- change
+	})
+	waitWatched(t, dp)
+	ctx := context.Background()
+	tests := []struct {
+		op     model.OperationType
+		status model.StatusType
+		reason string
+		// containers listed after the change
+		listed int
+	}{
+		{op: model.OperationTypePause, status: model.StatusTypePaused, reason: "pause", listed: 3},
+		{op: model.OperationTypeResume, status: model.StatusTypeWorking, reason: "unpause", listed: 3},
+		{op: model.OperationTypeDestroy, status: model.StatusTypeDestroyed, reason: "destroy", listed: 2},
+	}
+	for _, tt := range tests {
+		if err := entity(t, dp, "/db").Do(ctx, model.NewOperation(tt.op)); err != nil {
+			t.Fatalf("%s: %v", tt.op, err)
+		}
+		// destroy of running container is reported by kill and die first
+		for {
+			var change model.StatusChange
+			select {
+			case change = <-changes:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("No status change after %s", tt.op)
+			}
+			if change.Name != "/db" || change.EntityID != "c3" {
+				t.Errorf("Status change of %s %s, want /db c3", change.Name, change.EntityID)
+			}
+			if change.Reason == tt.reason {
+				if change.Status != tt.status {
+					t.Errorf("Status after %s = %s, want %s", tt.op, change.Status, tt.status)
+				}
+				break
+			}
+		}
+		entities, err := dp.Query(model.Query{Types: []model.EntityType{model.EntityTypeContainer}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entities) != tt.listed {
+			t.Errorf("%d containers listed after %s, want %d", len(entities), tt.op, tt.listed)
+		}
+	}
+	checkViolations(t, fa)
+}
+
+// swarmListings returns number of nodes, services and tasks listings agent got
+func swarmListings(fa *fakeagent.FakeAgent) int {
+	n := 0
+	for _, r := range fa.Requests() {
+		if r.Method == "GET" && (r.Path == "/nodes" || r.Path == "/services" || r.Path == "/tasks") {
+			n++
+		}
+	}
+	return n
+}
+
+// TestSwarmCache checks that nodes, services and tasks are listed
+// only when they could have changed
+func TestSwarmCache(t *testing.T) {
+	dp, fa, stop := newTestPlayground(t)
+	defer stop()
+	waitWatched(t, dp)
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		change func()
+		// wantListed is true if swarm should be listed after the change
+		wantListed bool
+		// wantTasks is number of tasks listed after the change
+		wantTasks int
+	}{
+		{name: "nothing changed", change: func() {}, wantTasks: 2},
+		{
+			name: "task started",
+			change: func() {
+				fa.AddTask("t3", "s1", "n1", 3)
+				fa.AddContainer("c4", "web.3.t3", "n1", "t3", map[string]string{"app": "web"})
+				// wait for the event
+				deadline := time.Now().Add(5 * time.Second)
+				for !hasEntity(dp, "/web.3.t3") && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+			},
+			wantListed: true,
+			wantTasks:  3,
+		},
+		{
+			name: "node drained",
+			change: func() {
+				if err := entity(t, dp, "node1").Do(ctx, model.NewOperation(model.OperationTypeDrain)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantListed: true,
+			wantTasks:  3,
+		},
+		{
+			name: "interval passed",
+			change: func() {
+				SwarmRefreshInterval = 0
+			},
+			wantListed: true,
+			wantTasks:  3,
+		},
+	}
+	defer func(interval time.Duration) {
+		SwarmRefreshInterval = interval
+	}(SwarmRefreshInterval)
+	for _, tt := range tests {
+		dp.Entities()
+		before := swarmListings(fa)
+		tt.change()
+		for i := 0; i < 3; i++ {
+			entities, err := dp.Entities()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				tasks := 0
+				for _, e := range entities {
+					if e.Type() == model.EntityTypeTask {
+						tasks++
+					}
+				}
+				if tasks != tt.wantTasks {
+					t.Errorf("%s: %d tasks listed, want %d", tt.name, tasks, tt.wantTasks)
+				}
+			}
+		}
+		if listed := swarmListings(fa) > before; listed != tt.wantListed {
+			t.Errorf("%s: swarm listed %v, want %v", tt.name, listed, tt.wantListed)
+		}
+	}
+	if status, _ := entity(t, dp, "node1").Status(ctx); status != model.StatusTypeStopped {
+		t.Errorf("Status of drained node = %s", status)
+	}
+	checkViolations(t, fa)
+}
+
+// nodeHealth returns health of the node with the hostname
+func nodeHealth(t *testing.T, dp *DockerPlayground, node string) model.NodeHealth {
+	t.Helper()
+	for _, h := range dp.Health() {
+		if h.Node == node {
+			return h
+		}
+	}
+	t.Fatalf("No health of node %s", node)
+	return model.NodeHealth{}
+}
+
+// TestNodeHealth checks that requests to the node that keeps failing
+// are refused for a while, and that node is healthy after it recovers
+func TestNodeHealth(t *testing.T) {
+	defer func(interval time.Duration) { healthRetryInterval = interval }(healthRetryInterval)
+	healthRetryInterval = 200 * time.Millisecond
+	dp, fa, stop := newTestPlayground(t)
+	defer stop()
+	ctx := context.Background()
+	e := entity(t, dp, "/web.2.t2")
+	if h := nodeHealth(t, dp, "node2"); !h.Healthy {
+		t.Fatalf("Node is unhealthy at start: %+v", h)
+	}
+	fa.SetNodeDown("node2", true)
+	for i := 0; i < unhealthyAfter; i++ {
+		if _, err := e.Status(ctx); err == nil {
+			t.Fatalf("Status of container on node that is down")
+		}
+	}
+	h := nodeHealth(t, dp, "node2")
+	if h.Healthy || h.Failures != unhealthyAfter || h.LastError == "" {
+		t.Errorf("Health after failures: %+v", h)
+	}
+	if h := nodeHealth(t, dp, "node1"); !h.Healthy {
+		t.Errorf("Other node is unhealthy: %+v", h)
+	}
+	requests := len(fa.Requests())
+	_, err := e.Status(ctx)
+	if model.ClassifyError(err) != model.ErrorClassTransient {
+		t.Errorf("Status of container on unhealthy node: %v, want transient error", err)
+	}
+	if n := len(fa.Requests()); n != requests {
+		t.Errorf("%d requests sent to unhealthy node", n-requests)
+	}
+	fa.SetNodeDown("node2", false)
+	time.Sleep(healthRetryInterval)
+	if status, err := e.Status(ctx); err != nil || status != model.StatusTypeWorking {
+		t.Errorf("Status after node recovered: %s, %v", status, err)
+	}
+	if h := nodeHealth(t, dp, "node2"); !h.Healthy || h.Failures != 0 || h.LastError != "" {
+		t.Errorf("Health after node recovered: %+v", h)
+	}
+	checkViolations(t, fa)
+}
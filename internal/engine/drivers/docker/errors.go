@@ -0,0 +1,23 @@
+package docker
+
+import (
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// classifyError marks docker API errors that are worth retrying
+// and ones caused by containers, tasks or nodes that are gone
+func classifyError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case client.IsErrNotFound(err):
+		return model.GoneError(err)
+	case client.IsErrConnectionFailed(err), errdefs.IsUnavailable(err),
+		errdefs.IsSystem(err), errdefs.IsDeadline(err):
+		// agent answers with system error if target node is unreachable
+		return model.TransientError(err)
+	}
+	return err
+}
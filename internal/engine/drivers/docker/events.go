@@ -0,0 +1,356 @@
+package docker
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// containerCache keeps containers of the swarm up to date
+	// using docker events, so they don't have to be listed
+	// on every Entities call
+	containerCache struct {
+		containers map[string]types.Container
+		// valid is false if events could be missed, containers
+		// should be listed again then
+		valid bool
+		// nodes events of which are watched, by hostname,
+		// value is false if node's events stream is broken
+		watched map[string]bool
+	}
+)
+
+// ResyncInterval is how often containers cache is fully refreshed
+var ResyncInterval = 5 * time.Minute
+
+// eventsRetryDelay is delay before resubscribing to broken events stream
+var eventsRetryDelay = 5 * time.Second
+
+// statusByAction maps container events to statuses containers get
+var statusByAction = map[string]model.StatusType{
+	"create":  model.StatusTypeWorking,
+	"start":   model.StatusTypeWorking,
+	"restart": model.StatusTypeWorking,
+	"unpause": model.StatusTypeWorking,
+	"pause":   model.StatusTypePaused,
+	"die":     model.StatusTypeDestroyed,
+	"destroy": model.StatusTypeDestroyed,
+}
+
+// NotifyStatus makes driver call listener on containers'
+// status changes reported by docker events
+func (dp *DockerPlayground) NotifyStatus(listener func(model.StatusChange)) {
+	dp.mu.Lock()
+	dp.listeners = append(dp.listeners, listener)
+	dp.mu.Unlock()
+}
+
+// Close stops watching docker events
+func (dp *DockerPlayground) Close() {
+	dp.cancel()
+}
+
+// listContainers returns containers selected by the query from the
+// cache, or lists them with docker filters if events are not watched
+func (dp *DockerPlayground) listContainers(ctx context.Context, q *model.Query) ([]types.Container, error) {
+	dp.mu.Lock()
+	valid, connected := dp.cache.valid, len(dp.cache.watched) > 0
+	for _, c := range dp.cache.watched {
+		connected = connected && c
+	}
+	dp.mu.Unlock()
+	if !connected {
+		// no events, so cache can't be kept up to date
+		if isEmptyQuery(q) {
+			return dp.resync(ctx)
+		}
+		options, err := containerListOptions(q)
+		if err != nil {
+			return nil, err
+		}
+		return dp.client.ContainerList(ctx, options)
+	}
+	if !valid {
+		if _, err := dp.resync(ctx); err != nil {
+			return nil, err
+		}
+	}
+	dp.mu.Lock()
+	res := make([]types.Container, 0, len(dp.cache.containers))
+	for _, c := range dp.cache.containers {
+		if matchContainer(&c, q) {
+			res = append(res, c)
+		}
+	}
+	dp.mu.Unlock()
+	// newest first, same as docker lists them
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Created != res[j].Created {
+			return res[i].Created > res[j].Created
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// resync lists all the containers and replaces the cache with them
+func (dp *DockerPlayground) resync(ctx context.Context) ([]types.Container, error) {
+	containers, err := dp.client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	cached := make(map[string]types.Container, len(containers))
+	for _, c := range containers {
+		cached[c.ID] = c
+	}
+	dp.mu.Lock()
+	dp.cache.containers = cached
+	dp.cache.valid = true
+	dp.mu.Unlock()
+	return containers, nil
+}
+
+// watch resyncs containers cache periodically and makes
+// sure events of every node are watched
+func (dp *DockerPlayground) watch(ctx context.Context) {
+	ticker := time.NewTicker(ResyncInterval)
+	defer ticker.Stop()
+	for {
+		dp.refreshSwarm(true)
+		hosts := []string{""}
+		if nodes := dp.getNodes(); len(nodes) > 0 {
+			hosts = hosts[:0]
+			for _, node := range nodes {
+				hosts = append(hosts, node.Description.Hostname)
+			}
+		}
+		dp.mu.Lock()
+		for _, host := range hosts {
+			if _, has := dp.cache.watched[host]; !has {
+				dp.cache.watched[host] = false
+				go dp.watchNode(ctx, host)
+			}
+		}
+		dp.mu.Unlock()
+		if _, err := dp.resync(ctx); err != nil {
+			glog.Infof("Error listing containers: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchNode follows container events of the node, host is
+// empty for docker that is not part of the swarm
+func (dp *DockerPlayground) watchNode(ctx context.Context, host string) {
+	// default client would break the stream after its timeout
+	cli, transport, err := dp.pool.newEventsClient(host)
+	if err != nil {
+		glog.Infof("Can't watch events of node %s: %v", host, err)
+		return
+	}
+	defer transport.CloseIdleConnections()
+	options := types.EventsOptions{
+		Filters: filters.NewArgs(filters.Arg("type", events.ContainerEventType)),
+	}
+	for {
+		messages, errs := cli.Events(ctx, options)
+		dp.setWatched(host, true)
+		glog.Infof("Watching events of node %s", host)
+	stream:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-messages:
+				dp.handleEvent(ctx, msg)
+			case err := <-errs:
+				glog.Infof("Events stream of node %s broken: %v", host, err)
+				break stream
+			}
+		}
+		dp.setWatched(host, false)
+		if host != "" && !dp.hasNode(host) {
+			glog.Infof("Node %s left the swarm, not watching it anymore", host)
+			dp.mu.Lock()
+			delete(dp.cache.watched, host)
+			dp.mu.Unlock()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryDelay):
+		}
+	}
+}
+
+// setWatched marks node's events stream connected or broken.
+// Events could be missed while it was broken, so cache is not
+// valid till the next resync.
+func (dp *DockerPlayground) setWatched(host string, connected bool) {
+	dp.mu.Lock()
+	if !connected || !dp.cache.watched[host] {
+		dp.cache.valid = false
+	}
+	dp.cache.watched[host] = connected
+	dp.mu.Unlock()
+}
+
+func (dp *DockerPlayground) hasNode(host string) bool {
+	for _, node := range dp.getNodes() {
+		if node.Description.Hostname == host {
+			return true
+		}
+	}
+	return false
+}
+
+// handleEvent updates container in the cache and notifies
+// listeners about its status change. Swarm cache is refreshed
+// when containers of the tasks come and go.
+func (dp *DockerPlayground) handleEvent(ctx context.Context, msg events.Message) {
+	status, tracked := statusByAction[msg.Action]
+	if !tracked {
+		return
+	}
+	if _, isHelper := msg.Actor.Attributes[helperLabel]; isHelper {
+		return
+	}
+	id := msg.Actor.ID
+	glog.V(2).Infof("Container %s event %s", id, msg.Action)
+	if _, isTask := msg.Actor.Attributes[swarmTaskIDLabel]; isTask && (msg.Action == "create" || msg.Action == "destroy") {
+		// task started or replaced
+		dp.invalidateSwarm()
+	}
+	if msg.Action == "destroy" {
+		dp.mu.Lock()
+		delete(dp.cache.containers, id)
+		dp.mu.Unlock()
+	} else {
+		containers, err := dp.client.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("id", id)),
+		})
+		dp.mu.Lock()
+		if err != nil {
+			glog.Infof("Error getting container %s: %v", id, err)
+			dp.cache.valid = false
+		} else {
+			for _, c := range containers {
+				dp.cache.containers[c.ID] = c
+			}
+		}
+		dp.mu.Unlock()
+	}
+	reason := msg.Action
+	if code, has := msg.Actor.Attributes["exitCode"]; has {
+		reason += " (exit code " + code + ")"
+	}
+	change := model.StatusChange{
+		Time:     time.Unix(0, msg.TimeNano),
+		EntityID: id,
+		Name:     "/" + msg.Actor.Attributes["name"],
+		Type:     model.EntityTypeContainer,
+		Status:   status,
+		Reason:   reason,
+	}
+	dp.mu.Lock()
+	listeners := dp.listeners
+	dp.mu.Unlock()
+	for _, listener := range listeners {
+		listener(change)
+	}
+}
+
+func isEmptyQuery(q *model.Query) bool {
+	return len(q.Labels) == 0 && q.Name == "" && !q.Running
+}
+
+// containerListOptions converts query to docker filters
+func containerListOptions(q *model.Query) (types.ContainerListOptions, error) {
+	args := filters.NewArgs()
+	for k, v := range q.Labels {
+		args.Add("label", k+"="+v)
+	}
+	if q.Name != "" {
+		re, err := globToRegexp(q.Name)
+		if err != nil {
+			return types.ContainerListOptions{}, err
+		}
+		args.Add("name", re)
+	}
+	return types.ContainerListOptions{
+		// stopped containers are listed only if asked for
+		All:     !q.Running,
+		Filters: args,
+	}, nil
+}
+
+// matchContainer returns true if cached container is selected by the query
+func matchContainer(c *types.Container, q *model.Query) bool {
+	if q.Running && c.State != "running" {
+		return false
+	}
+	for k, v := range q.Labels {
+		if c.Labels[k] != v {
+			return false
+		}
+	}
+	if q.Name != "" {
+		matched := false
+		for _, name := range c.Names {
+			if m, _ := path.Match(q.Name, name); m {
+				matched = true
+				break
+			}
+		}
+		return matched
+	}
+	return true
+}
+
+// globToRegexp converts glob pattern to the anchored regular
+// expression docker name filter takes
+func globToRegexp(pattern string) (string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(pattern[i:], ']')
+			// classes have the same syntax, escapes included
+			sb.WriteString(pattern[i : i+j+1])
+			i += j
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String(), nil
+}
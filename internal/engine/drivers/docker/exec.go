@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/golang/glog"
+)
+
+// exec runs command inside the container and returns its output
+func (dc *dockerContainer) exec(ctx context.Context, cmd ...string) (string, error) {
+	client, err := dc.getClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.ContainerExecCreate(ctx, dc.container.ID, types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return "", err
+	}
+	hijacked, err := client.ContainerExecAttach(ctx, resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", err
+	}
+	defer hijacked.Close()
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, hijacked.Reader); err != nil {
+		return "", err
+	}
+	inspect, err := client.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return "", err
+	}
+	if inspect.ExitCode != 0 {
+		return "", fmt.Errorf("Command %v in container %s exited with code %d: %s", cmd, dc.Name(), inspect.ExitCode, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// execDetached starts command inside the container without waiting for it to finish
+func (dc *dockerContainer) execDetached(ctx context.Context, cmd ...string) error {
+	client, err := dc.getClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.ContainerExecCreate(ctx, dc.container.ID, types.ExecConfig{
+		Detach: true,
+		Cmd:    cmd,
+	})
+	if err != nil {
+		return err
+	}
+	glog.Infof("Starting %v in container %s", cmd, dc.Name())
+	return client.ContainerExecStart(ctx, resp.ID, types.ExecStartCheck{Detach: true})
+}
@@ -0,0 +1,620 @@
+// Package fakeagent provides an in-memory stand-in for the Portainer
+// agent in front of a swarm, so the docker driver can be exercised
+// end-to-end without a docker daemon.
+package fakeagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+type (
+	// FakeAgent serves subset of Docker Engine and Swarm API the
+	// docker driver uses. It checks that requests carry Portainer
+	// headers and that requests concerning containers are routed
+	// by X-PortainerAgent-Target to the nodes containers run on.
+	FakeAgent struct {
+		server     *httptest.Server
+		mu         sync.Mutex
+		nodes      []*swarm.Node
+		services   []swarm.Service
+		tasks      []swarm.Task
+		containers []*fakeContainer
+		requests   []Request
+		violations []string
+		// events streams, by hostname of the node they watch
+		subscribers map[chan events.Message]string
+		// down are hostnames of the nodes agent can't reach
+		down map[string]bool
+	}
+
+	// Request is a record of the request agent got
+	Request struct {
+		Method string
+		// Path without API version prefix
+		Path string
+		// Target is value of X-PortainerAgent-Target header
+		Target string
+	}
+
+	fakeContainer struct {
+		container types.Container
+		// hostname of the node container runs on
+		node string
+	}
+)
+
+const (
+	// APIVersion is docker API version agent reports
+	APIVersion = "1.40"
+
+	targetHeader    = "X-PortainerAgent-Target"
+	publicKeyHeader = "X-PortainerAgent-PublicKey"
+	signatureHeader = "X-PortainerAgent-Signature"
+	// swarmNodeIDLabel is label swarm puts on containers of the tasks
+	swarmNodeIDLabel = "com.docker.swarm.node.id"
+)
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+/`)
+
+// NewFakeAgent starts a new fake agent serving HTTPS with self-signed
+// certificate, same as the real one. Close should be called
+// to stop it.
+func NewFakeAgent() *FakeAgent {
+	fa := &FakeAgent{
+		subscribers: make(map[chan events.Message]string),
+		down:        make(map[string]bool),
+	}
+	fa.server = httptest.NewTLSServer(http.HandlerFunc(fa.handle))
+	return fa
+}
+
+// Host returns url of the agent to be used as docker host
+func (fa *FakeAgent) Host() string {
+	return "tcp://" + fa.server.Listener.Addr().String()
+}
+
+// Close stops the agent
+func (fa *FakeAgent) Close() {
+	fa.server.Close()
+}
+
+// AddNode adds swarm node. First node added is the one agent runs on,
+// requests without target are served by it.
+func (fa *FakeAgent) AddNode(id, hostname string) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	node := &swarm.Node{
+		ID: id,
+		Spec: swarm.NodeSpec{
+			Availability: swarm.NodeAvailabilityActive,
+		},
+		Description: swarm.NodeDescription{
+			Hostname: hostname,
+		},
+		Status: swarm.NodeStatus{
+			State: swarm.NodeStateReady,
+		},
+	}
+	node.Version.Index = 1
+	fa.nodes = append(fa.nodes, node)
+}
+
+// SetNodeDown makes requests routed to the node fail
+// with 502 Bad Gateway, as agent can't reach it
+func (fa *FakeAgent) SetNodeDown(hostname string, down bool) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	fa.down[hostname] = down
+}
+
+// AddService adds swarm service
+func (fa *FakeAgent) AddService(id, name string) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	service := swarm.Service{ID: id}
+	service.Spec.Name = name
+	fa.services = append(fa.services, service)
+}
+
+// AddContainer adds running container on the node, container of
+// the task if taskID is not empty
+func (fa *FakeAgent) AddContainer(id, name, nodeID, taskID string, labels map[string]string) error {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	node := fa.nodeByID(nodeID)
+	if node == nil {
+		return fmt.Errorf("No node %s", nodeID)
+	}
+	l := map[string]string{swarmNodeIDLabel: nodeID}
+	for k, v := range labels {
+		l[k] = v
+	}
+	if taskID != "" {
+		var task *swarm.Task
+		for i := range fa.tasks {
+			if fa.tasks[i].ID == taskID {
+				task = &fa.tasks[i]
+			}
+		}
+		if task == nil {
+			return fmt.Errorf("No task %s", taskID)
+		}
+		task.Status.ContainerStatus = &swarm.ContainerStatus{ContainerID: id}
+		l["com.docker.swarm.task.id"] = taskID
+		l["com.docker.swarm.service.id"] = task.ServiceID
+		for _, s := range fa.services {
+			if s.ID == task.ServiceID {
+				l["com.docker.swarm.service.name"] = s.Spec.Name
+			}
+		}
+	}
+	fc := &fakeContainer{
+		container: types.Container{
+			ID:      id,
+			Names:   []string{"/" + name},
+			Labels:  l,
+			State:   "running",
+			Created: time.Now().Unix(),
+		},
+		node: node.Description.Hostname,
+	}
+	fa.containers = append(fa.containers, fc)
+	fa.emit(fc, "create")
+	fa.emit(fc, "start")
+	return nil
+}
+
+// AddTask adds running task of the service on the node
+func (fa *FakeAgent) AddTask(id, serviceID, nodeID string, slot int) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	fa.tasks = append(fa.tasks, swarm.Task{
+		ID:           id,
+		ServiceID:    serviceID,
+		NodeID:       nodeID,
+		Slot:         slot,
+		DesiredState: swarm.TaskStateRunning,
+		Status: swarm.TaskStatus{
+			State: swarm.TaskStateRunning,
+		},
+	})
+}
+
+// ContainerState returns state of the container (running, paused,
+// exited), false if container doesn't exist
+func (fa *FakeAgent) ContainerState(id string) (string, bool) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	fc := fa.containerByID(id)
+	if fc == nil {
+		return "", false
+	}
+	return fc.container.State, true
+}
+
+// NodeAvailability returns availability of the node
+func (fa *FakeAgent) NodeAvailability(id string) swarm.NodeAvailability {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	if node := fa.nodeByID(id); node != nil {
+		return node.Spec.Availability
+	}
+	return ""
+}
+
+// Requests returns all the requests agent got
+func (fa *FakeAgent) Requests() []Request {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	return append([]Request(nil), fa.requests...)
+}
+
+// Violations returns descriptions of the requests that
+// lacked Portainer headers or were routed to the wrong node
+func (fa *FakeAgent) Violations() []string {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	return append([]string(nil), fa.violations...)
+}
+
+func (fa *FakeAgent) nodeByID(id string) *swarm.Node {
+	for _, node := range fa.nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+func (fa *FakeAgent) containerByID(id string) *fakeContainer {
+	for _, fc := range fa.containers {
+		if fc.container.ID == id || strings.TrimPrefix(fc.container.Names[0], "/") == id {
+			return fc
+		}
+	}
+	return nil
+}
+
+// localNode returns hostname of the node agent runs on
+func (fa *FakeAgent) localNode() string {
+	if len(fa.nodes) == 0 {
+		return ""
+	}
+	return fa.nodes[0].Description.Hostname
+}
+
+func (fa *FakeAgent) violation(format string, args ...interface{}) {
+	fa.violations = append(fa.violations, fmt.Sprintf(format, args...))
+}
+
+// emit sends container's event to the streams watching its node
+func (fa *FakeAgent) emit(fc *fakeContainer, action string) {
+	now := time.Now()
+	attributes := map[string]string{
+		"name": strings.TrimPrefix(fc.container.Names[0], "/"),
+	}
+	for k, v := range fc.container.Labels {
+		attributes[k] = v
+	}
+	if action == "die" {
+		attributes["exitCode"] = "137"
+	}
+	msg := events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         fc.container.ID,
+			Attributes: attributes,
+		},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+	for ch, node := range fa.subscribers {
+		if node == fc.node {
+			select {
+			case ch <- msg:
+			default:
+				// slow reader, real daemon would drop it too
+			}
+		}
+	}
+}
+
+// checkRequest records request and checks it is signed
+func (fa *FakeAgent) checkRequest(w http.ResponseWriter, r *http.Request, path, target string) bool {
+	fa.requests = append(fa.requests, Request{
+		Method: r.Method,
+		Path:   path,
+		Target: target,
+	})
+	if path == "/_ping" {
+		return true
+	}
+	if r.Header.Get(publicKeyHeader) == "" || r.Header.Get(signatureHeader) == "" {
+		fa.violation("%s %s: no Portainer signature", r.Method, path)
+		writeError(w, http.StatusForbidden, "Unauthorized")
+		return false
+	}
+	return true
+}
+
+func (fa *FakeAgent) handle(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "/")
+	target := r.Header.Get(targetHeader)
+	if path == "/events" {
+		fa.streamEvents(w, r, target)
+		return
+	}
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	if !fa.checkRequest(w, r, path, target) {
+		return
+	}
+	if fa.down[target] {
+		writeError(w, http.StatusBadGateway, "node "+target+" is unreachable")
+		return
+	}
+	if path == "/_ping" {
+		w.Header().Set("Api-Version", APIVersion)
+		w.Write([]byte("OK"))
+		return
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch parts[0] {
+	case "containers":
+		if len(parts) == 2 && parts[1] == "json" {
+			fa.listContainers(w, r, target)
+			return
+		}
+		if len(parts) >= 2 {
+			fa.handleContainer(w, r, parts[1], parts[2:], target)
+			return
+		}
+	case "nodes":
+		fa.handleNodes(w, r, parts[1:])
+		return
+	case "services":
+		if len(parts) == 1 && r.Method == http.MethodGet {
+			writeJSON(w, fa.services)
+			return
+		}
+	case "tasks":
+		if len(parts) == 1 && r.Method == http.MethodGet {
+			fa.listTasks(w, r)
+			return
+		}
+		if len(parts) == 2 && r.Method == http.MethodGet {
+			for _, task := range fa.tasks {
+				if task.ID == parts[1] {
+					writeJSON(w, task)
+					return
+				}
+			}
+			writeError(w, http.StatusNotFound, "task "+parts[1]+" not found")
+			return
+		}
+	}
+	writeError(w, http.StatusNotImplemented, fmt.Sprintf("%s %s is not implemented by fake agent", r.Method, path))
+}
+
+// streamEvents streams container events of the target node
+// until client disconnects
+func (fa *FakeAgent) streamEvents(w http.ResponseWriter, r *http.Request, target string) {
+	fa.mu.Lock()
+	if !fa.checkRequest(w, r, "/events", target) {
+		fa.mu.Unlock()
+		return
+	}
+	if target == "" {
+		target = fa.localNode()
+	}
+	ch := make(chan events.Message, 100)
+	fa.subscribers[ch] = target
+	fa.mu.Unlock()
+	defer func() {
+		fa.mu.Lock()
+		delete(fa.subscribers, ch)
+		fa.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			if err := enc.Encode(msg); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// CloseEvents breaks all the events streams, as if agent was restarted
+func (fa *FakeAgent) CloseEvents() {
+	fa.server.CloseClientConnections()
+}
+
+func (fa *FakeAgent) listContainers(w http.ResponseWriter, r *http.Request, target string) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res := make([]types.Container, 0)
+	for _, fc := range fa.containers {
+		// agent lists containers of all the nodes if there is no target
+		if target != "" && fc.node != target {
+			continue
+		}
+		if !all && fc.container.State != "running" {
+			continue
+		}
+		if !args.MatchKVList("label", fc.container.Labels) {
+			continue
+		}
+		if args.Contains("status") && !args.ExactMatch("status", fc.container.State) {
+			continue
+		}
+		if args.Contains("name") && !args.Match("name", fc.container.Names[0]) {
+			continue
+		}
+		if args.Contains("id") && !args.Match("id", fc.container.ID) {
+			continue
+		}
+		res = append(res, fc.container)
+	}
+	writeJSON(w, res)
+}
+
+func (fa *FakeAgent) handleContainer(w http.ResponseWriter, r *http.Request, id string, action []string, target string) {
+	fc := fa.containerByID(id)
+	if fc == nil {
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+	if target == "" {
+		target = fa.localNode()
+	}
+	if fc.node != target {
+		// real agent forwards request to the target node,
+		// which doesn't have the container
+		fa.violation("%s %s: container %s runs on %s, request is routed to %s", r.Method, r.URL.Path, id, fc.node, target)
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+	c := &fc.container
+	op := ""
+	if len(action) > 0 {
+		op = action[0]
+	}
+	switch {
+	case op == "json" && r.Method == http.MethodGet:
+		writeJSON(w, inspect(fc))
+	case op == "" && r.Method == http.MethodDelete:
+		force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+		if c.State == "running" && !force {
+			writeError(w, http.StatusConflict, "You cannot remove a running container "+id)
+			return
+		}
+		for i := range fa.containers {
+			if fa.containers[i] == fc {
+				fa.containers = append(fa.containers[:i], fa.containers[i+1:]...)
+				break
+			}
+		}
+		if c.State == "running" || c.State == "paused" {
+			fa.emit(fc, "kill")
+			fa.emit(fc, "die")
+		}
+		fa.emit(fc, "destroy")
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method != http.MethodPost:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	case op == "pause":
+		if c.State != "running" {
+			writeError(w, http.StatusConflict, "Container "+id+" is not running")
+			return
+		}
+		c.State = "paused"
+		fa.emit(fc, "pause")
+		w.WriteHeader(http.StatusNoContent)
+	case op == "unpause":
+		if c.State != "paused" {
+			writeError(w, http.StatusConflict, "Container "+id+" is not paused")
+			return
+		}
+		c.State = "running"
+		fa.emit(fc, "unpause")
+		w.WriteHeader(http.StatusNoContent)
+	case op == "stop", op == "kill":
+		if c.State != "running" && c.State != "paused" {
+			writeError(w, http.StatusConflict, "Container "+id+" is not running")
+			return
+		}
+		c.State = "exited"
+		fa.emit(fc, op)
+		fa.emit(fc, "die")
+		w.WriteHeader(http.StatusNoContent)
+	case op == "start", op == "restart":
+		c.State = "running"
+		fa.emit(fc, op)
+		w.WriteHeader(http.StatusNoContent)
+	case op == "update":
+		writeJSON(w, map[string][]string{"Warnings": {}})
+	default:
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("%s %s is not implemented by fake agent", r.Method, r.URL.Path))
+	}
+}
+
+func inspect(fc *fakeContainer) types.ContainerJSON {
+	c := &fc.container
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   c.ID,
+			Name: c.Names[0],
+			State: &types.ContainerState{
+				Status:  c.State,
+				Running: c.State == "running" || c.State == "paused",
+				Paused:  c.State == "paused",
+			},
+			HostConfig: &container.HostConfig{},
+		},
+		Config: &container.Config{
+			Labels: c.Labels,
+		},
+	}
+}
+
+func (fa *FakeAgent) handleNodes(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 {
+		res := make([]swarm.Node, 0, len(fa.nodes))
+		for _, node := range fa.nodes {
+			res = append(res, *node)
+		}
+		writeJSON(w, res)
+		return
+	}
+	node := fa.nodeByID(parts[0])
+	if node == nil {
+		writeError(w, http.StatusNotFound, "node "+parts[0]+" not found")
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, node)
+	case len(parts) == 2 && parts[1] == "update" && r.Method == http.MethodPost:
+		version, err := strconv.ParseUint(r.URL.Query().Get("version"), 10, 64)
+		if err != nil || version != node.Version.Index {
+			writeError(w, http.StatusInternalServerError, "update out of sequence")
+			return
+		}
+		spec := swarm.NodeSpec{}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		node.Spec = spec
+		node.Version.Index++
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("%s %s is not implemented by fake agent", r.Method, r.URL.Path))
+	}
+}
+
+func (fa *FakeAgent) listTasks(w http.ResponseWriter, r *http.Request) {
+	args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res := make([]swarm.Task, 0)
+	for _, task := range fa.tasks {
+		if args.Contains("desired-state") && !args.ExactMatch("desired-state", string(task.DesiredState)) {
+			continue
+		}
+		if args.Contains("service") && !args.ExactMatch("service", task.ServiceID) {
+			continue
+		}
+		if args.Contains("node") && !args.ExactMatch("node", task.NodeID) {
+			continue
+		}
+		res = append(res, task)
+	}
+	writeJSON(w, res)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
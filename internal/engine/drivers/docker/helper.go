@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/golang/glog"
+)
+
+// HelperImage is image of the sidecar containers used to inject
+// network faults. It should have sh, iptables and tc.
+var HelperImage = "nicolaka/netshoot"
+
+// helperLabel marks helper containers with id of the container they are attached to
+const helperLabel = "org.livepeer.swarm-chaos.helper-for"
+
+// helperStopTimeout is how long helper has to revert the fault when stopped
+var helperStopTimeout = 10 * time.Second
+
+// runNetworkHelper starts sidecar container sharing network namespace
+// of the container. Sidecar runs apply script, waits for duration
+// and then runs revert script. Revert script is also run if the
+// sidecar is stopped earlier.
+func (dc *dockerContainer) runNetworkHelper(ctx context.Context, duration time.Duration, apply, revert string) error {
+	client, err := dc.getClient()
+	if err != nil {
+		return err
+	}
+	if err := ensureImage(ctx, client, HelperImage); err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`trap '%s; exit 0' TERM INT; if ! (set -e; %s); then %s; exit 1; fi; sleep %d & wait; %s`,
+		revert, apply, revert, int(duration.Seconds()), revert)
+	resp, err := client.ContainerCreate(ctx, &container.Config{
+		Image: HelperImage,
+		Cmd:   []string{"sh", "-c", script},
+		Labels: map[string]string{
+			helperLabel: dc.container.ID,
+		},
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode("container:" + dc.container.ID),
+		CapAdd:      []string{"NET_ADMIN"},
+		AutoRemove:  true,
+	}, nil, "")
+	if err != nil {
+		return err
+	}
+	glog.Infof("Starting network helper %s for container %s: %s", resp.ID, dc.Name(), apply)
+	if err := client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		client.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+		return err
+	}
+	dc.dp.mu.Lock()
+	dc.dp.networkHelpers[dc.container.ID] = append(dc.dp.networkHelpers[dc.container.ID], resp.ID)
+	dc.dp.mu.Unlock()
+	time.AfterFunc(duration, func() {
+		dc.dp.forgetNetworkHelper(dc.container.ID, resp.ID)
+	})
+	return nil
+}
+
+// stopNetworkHelpers reverts all the network faults of the container
+func (dc *dockerContainer) stopNetworkHelpers(ctx context.Context) error {
+	client, err := dc.getClient()
+	if err != nil {
+		return err
+	}
+	dc.dp.mu.Lock()
+	helpers := dc.dp.networkHelpers[dc.container.ID]
+	delete(dc.dp.networkHelpers, dc.container.ID)
+	dc.dp.mu.Unlock()
+	var lastErr error
+	for _, id := range helpers {
+		glog.Infof("Stopping network helper %s of container %s", id, dc.Name())
+		if err := client.ContainerStop(ctx, id, &helperStopTimeout); err != nil && !isNotFound(err) {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// hasNetworkHelpers returns true if container has network faults injected
+func (dc *dockerContainer) hasNetworkHelpers() bool {
+	dc.dp.mu.Lock()
+	defer dc.dp.mu.Unlock()
+	return len(dc.dp.networkHelpers[dc.container.ID]) > 0
+}
+
+func (dp *DockerPlayground) forgetNetworkHelper(containerID, helperID string) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	helpers := dp.networkHelpers[containerID]
+	for i, id := range helpers {
+		if id == helperID {
+			helpers = append(helpers[:i], helpers[i+1:]...)
+			break
+		}
+	}
+	if len(helpers) == 0 {
+		delete(dp.networkHelpers, containerID)
+	} else {
+		dp.networkHelpers[containerID] = helpers
+	}
+}
+
+// ensureImage pulls image if it is not present on the node
+func ensureImage(ctx context.Context, cli *client.Client, image string) error {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	}
+	glog.Infof("Pulling image %s", image)
+	rc, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(ioutil.Discard, rc)
+	return err
+}
+
+func isNotFound(err error) bool {
+	return client.IsErrNotFound(err)
+}
@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// dockerNode is a swarm node. Pausing or draining it
+	// simulates losing a whole machine in the swarm.
+	dockerNode struct {
+		node   swarm.Node
+		dp     *DockerPlayground
+		childs []model.Entity
+	}
+)
+
+func (dn *dockerNode) ID() string {
+	return dn.node.ID
+}
+
+func (dn *dockerNode) Name() string {
+	if dn.node.Description.Hostname != "" {
+		return dn.node.Description.Hostname
+	}
+	return dn.node.ID
+}
+
+func (dn *dockerNode) Labels() map[string]string {
+	return dn.node.Spec.Labels
+}
+
+func (dn *dockerNode) Parent() model.Entity {
+	return nil
+}
+
+// Childs returns service tasks and standalone containers running on the node
+func (dn *dockerNode) Childs() []model.Entity {
+	return dn.childs
+}
+
+func (dn *dockerNode) Type() model.EntityType {
+	return model.EntityTypeVM
+}
+
+func (dn *dockerNode) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(dn.do(ctx, operation))
+}
+
+func (dn *dockerNode) do(ctx context.Context, operation model.Operation) error {
+	switch operation.Type {
+	case model.OperationTypePause:
+		return dn.setAvailability(ctx, swarm.NodeAvailabilityPause)
+	case model.OperationTypeDrain:
+		return dn.setAvailability(ctx, swarm.NodeAvailabilityDrain)
+	case model.OperationTypeResume:
+		return dn.restoreAvailability(ctx)
+	}
+	return model.ErrOperationNotSupported
+}
+
+func (dn *dockerNode) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := dn.status(ctx)
+	return status, classifyError(err)
+}
+
+func (dn *dockerNode) status(ctx context.Context) (model.StatusType, error) {
+	node, _, err := dn.dp.client.NodeInspectWithRaw(ctx, dn.node.ID)
+	if err != nil {
+		return 0, err
+	}
+	if node.Status.State == swarm.NodeStateDown || node.Status.State == swarm.NodeStateDisconnected {
+		return model.StatusTypeDestroyed, nil
+	}
+	switch node.Spec.Availability {
+	case swarm.NodeAvailabilityPause:
+		return model.StatusTypePaused, nil
+	case swarm.NodeAvailabilityDrain:
+		return model.StatusTypeStopped, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+// isNodeWorking returns true if node is up and is not paused or drained
+func isNodeWorking(node swarm.Node) bool {
+	if node.Status.State == swarm.NodeStateDown || node.Status.State == swarm.NodeStateDisconnected {
+		return false
+	}
+	return node.Spec.Availability == swarm.NodeAvailabilityActive
+}
+
+// setAvailability changes node's availability, remembering
+// the original one so it can be restored later
+func (dn *dockerNode) setAvailability(ctx context.Context, availability swarm.NodeAvailability) error {
+	node, _, err := dn.dp.client.NodeInspectWithRaw(ctx, dn.node.ID)
+	if err != nil {
+		return err
+	}
+	dn.dp.mu.Lock()
+	if _, has := dn.dp.savedAvailability[node.ID]; !has {
+		dn.dp.savedAvailability[node.ID] = node.Spec.Availability
+	}
+	dn.dp.mu.Unlock()
+	glog.Infof("Setting availability of node %s to %s", dn.Name(), availability)
+	spec := node.Spec
+	spec.Availability = availability
+	return dn.dp.updateNode(ctx, node, spec)
+}
+
+// restoreAvailability sets node's availability back to the one
+// it had before being paused or drained
+func (dn *dockerNode) restoreAvailability(ctx context.Context) error {
+	node, _, err := dn.dp.client.NodeInspectWithRaw(ctx, dn.node.ID)
+	if err != nil {
+		return err
+	}
+	dn.dp.mu.Lock()
+	availability, has := dn.dp.savedAvailability[node.ID]
+	delete(dn.dp.savedAvailability, node.ID)
+	dn.dp.mu.Unlock()
+	if !has {
+		availability = swarm.NodeAvailabilityActive
+	}
+	if node.Spec.Availability == availability {
+		return nil
+	}
+	glog.Infof("Restoring availability of node %s to %s", dn.Name(), availability)
+	spec := node.Spec
+	spec.Availability = availability
+	return dn.dp.updateNode(ctx, node, spec)
+}
+
+// updateNode updates node's spec, making cached nodes listed again
+func (dp *DockerPlayground) updateNode(ctx context.Context, node swarm.Node, spec swarm.NodeSpec) error {
+	err := dp.client.NodeUpdate(ctx, node.ID, node.Version, spec)
+	dp.invalidateSwarm()
+	return err
+}
@@ -0,0 +1,181 @@
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// nodeClient is client of one node, reused by all its containers
+	nodeClient struct {
+		client    *client.Client
+		transport *http.Transport
+		health    model.NodeHealth
+	}
+
+	// clientPool keeps clients of the swarm nodes keyed by hostname
+	clientPool struct {
+		mu        sync.Mutex
+		agentHost string
+		clients   map[string]*nodeClient
+	}
+
+	// healthTransport reports results of the requests to the pool
+	healthTransport struct {
+		next   http.RoundTripper
+		report func(err error)
+	}
+)
+
+// unhealthyAfter is number of consecutive failures that make node unhealthy
+var unhealthyAfter = 3
+
+// healthRetryInterval is how long requests to unhealthy node are
+// refused before it is tried again
+var healthRetryInterval = 30 * time.Second
+
+func newClientPool(agentHost string) *clientPool {
+	return &clientPool{
+		agentHost: agentHost,
+		clients:   make(map[string]*nodeClient),
+	}
+}
+
+// get returns client of the node, creating it if needed. Error is
+// returned if node is unhealthy and it is not time to retry it yet.
+func (cp *clientPool) get(node string) (*client.Client, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	nc, has := cp.clients[node]
+	if !has {
+		var err error
+		if nc, err = cp.newNodeClient(node); err != nil {
+			return nil, err
+		}
+		cp.clients[node] = nc
+	}
+	if !nc.health.Healthy && time.Since(nc.health.LastCheck) < healthRetryInterval {
+		return nil, model.TransientError(fmt.Errorf("Node %q is unhealthy: %s", node, nc.health.LastError))
+	}
+	return nc.client, nil
+}
+
+// newEventsClient returns a new client without timeout, so it can be
+// used for long lived events stream, and its transport to close
+func (cp *clientPool) newEventsClient(node string) (*client.Client, *http.Transport, error) {
+	return newPortainerAgentClient(cp.agentHost, node, 0, func(err error) {
+		cp.report(node, err)
+	})
+}
+
+func (cp *clientPool) newNodeClient(node string) (*nodeClient, error) {
+	cli, transport, err := newPortainerAgentClient(cp.agentHost, node, HTTPTimeout, func(err error) {
+		cp.report(node, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &nodeClient{
+		client:    cli,
+		transport: transport,
+		health:    model.NodeHealth{Node: node, Healthy: true},
+	}, nil
+}
+
+// sync creates clients of the nodes that joined the swarm
+// and drops clients of the nodes that left it
+func (cp *clientPool) sync(nodes []string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	current := map[string]bool{"": true}
+	for _, node := range nodes {
+		current[node] = true
+		if _, has := cp.clients[node]; has {
+			continue
+		}
+		nc, err := cp.newNodeClient(node)
+		if err != nil {
+			glog.Infof("Can't create client of node %s: %v", node, err)
+			continue
+		}
+		glog.V(2).Infof("Node %s joined, client created", node)
+		cp.clients[node] = nc
+	}
+	for node, nc := range cp.clients {
+		if !current[node] {
+			glog.Infof("Node %s left, dropping its client", node)
+			nc.transport.CloseIdleConnections()
+			delete(cp.clients, node)
+		}
+	}
+}
+
+// report records result of the request to the node
+func (cp *clientPool) report(node string, err error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	nc, has := cp.clients[node]
+	if !has {
+		return
+	}
+	h := &nc.health
+	h.LastCheck = time.Now()
+	if err == nil {
+		if !h.Healthy {
+			glog.Infof("Node %s is healthy again", node)
+		}
+		h.Healthy = true
+		h.Failures = 0
+		h.LastError = ""
+		return
+	}
+	h.Failures++
+	h.LastError = err.Error()
+	if h.Healthy && h.Failures >= unhealthyAfter {
+		glog.Infof("Node %s is unhealthy after %d failures: %v", node, h.Failures, err)
+		h.Healthy = false
+	}
+}
+
+// health returns health of all the known nodes sorted by hostname
+func (cp *clientPool) health() []model.NodeHealth {
+	cp.mu.Lock()
+	res := make([]model.NodeHealth, 0, len(cp.clients))
+	for _, nc := range cp.clients {
+		res = append(res, nc.health)
+	}
+	cp.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Node < res[j].Node })
+	return res
+}
+
+// Health returns health of docker API of the swarm nodes reached
+// through the agent, node of the agent itself has empty name
+func (dp *DockerPlayground) Health() []model.NodeHealth {
+	return dp.pool.health()
+}
+
+func (ht *healthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := ht.next.RoundTrip(req)
+	if req.Context().Err() != nil {
+		// cancelled by caller, says nothing about the node
+		return resp, err
+	}
+	switch {
+	case err != nil:
+		ht.report(err)
+	case resp.StatusCode == http.StatusBadGateway, resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		ht.report(fmt.Errorf("Agent responded %s", resp.Status))
+	default:
+		ht.report(nil)
+	}
+	return resp, err
+}
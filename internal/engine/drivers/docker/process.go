@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// dockerProcess is a process running inside the container
+	dockerProcess struct {
+		container *dockerContainer
+		// pid inside container's pid namespace
+		pid  string
+		comm string
+	}
+)
+
+// KillSignal is signal sent to the containers and processes by the kill operation
+var KillSignal = "SIGKILL"
+
+// listProcessesCmd lists processes of the container as 'pid comm' lines
+// using only shell builtins, so it works even without ps in the image
+const listProcessesCmd = `for p in /proc/[0-9]*; do [ "${p#/proc/}" = "$$" ] && continue; read c < $p/comm 2>/dev/null && echo "${p#/proc/} $c"; done`
+
+// listProcesses discovers processes running inside the container
+func (dc *dockerContainer) listProcesses(ctx context.Context) ([]*dockerProcess, error) {
+	out, err := dc.exec(ctx, "sh", "-c", listProcessesCmd)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*dockerProcess, 0)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		res = append(res, &dockerProcess{
+			container: dc,
+			pid:       fields[0],
+			comm:      fields[1],
+		})
+	}
+	return res, nil
+}
+
+func (pr *dockerProcess) ID() string {
+	return pr.container.ID() + "/" + pr.pid
+}
+
+// Name returns name of the process' executable,
+// so processes can be selected by it (ffmpeg, livepeer)
+func (pr *dockerProcess) Name() string {
+	return pr.comm
+}
+
+// Labels returns labels of the process' container
+func (pr *dockerProcess) Labels() map[string]string {
+	return pr.container.Labels()
+}
+
+func (pr *dockerProcess) Parent() model.Entity {
+	return pr.container
+}
+
+func (pr *dockerProcess) Childs() []model.Entity {
+	return nil
+}
+
+func (pr *dockerProcess) Type() model.EntityType {
+	return model.EntityTypeProcess
+}
+
+func (pr *dockerProcess) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(pr.do(ctx, operation))
+}
+
+func (pr *dockerProcess) do(ctx context.Context, operation model.Operation) error {
+	switch operation.Type {
+	case model.OperationTypeDestroy:
+		return pr.signal(ctx, "SIGKILL")
+	case model.OperationTypeStop:
+		return pr.signal(ctx, "SIGTERM")
+	case model.OperationTypePause:
+		return pr.signal(ctx, "SIGSTOP")
+	case model.OperationTypeResume:
+		return pr.signal(ctx, "SIGCONT")
+	case model.OperationTypeKill:
+		return pr.signal(ctx, operation.Param(model.ParamSignal.Name, KillSignal))
+	}
+	return model.ErrOperationNotSupported
+}
+
+func (pr *dockerProcess) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := pr.status(ctx)
+	return status, classifyError(err)
+}
+
+func (pr *dockerProcess) status(ctx context.Context) (model.StatusType, error) {
+	out, err := pr.container.exec(ctx, "sh", "-c", "cat /proc/"+pr.pid+"/stat 2>/dev/null || true")
+	if err != nil {
+		return 0, err
+	}
+	// format is 'pid (comm) state ...', comm can contain spaces
+	i := strings.LastIndex(out, ")")
+	if i < 0 || len(out) < i+3 {
+		return model.StatusTypeDestroyed, nil
+	}
+	switch out[i+2] {
+	case 'T', 't':
+		return model.StatusTypePaused, nil
+	case 'Z', 'X', 'x':
+		return model.StatusTypeDestroyed, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+func (pr *dockerProcess) signal(ctx context.Context, signal string) error {
+	signal, err := model.ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Sending %s to process %s (%s) in container %s", signal, pr.pid, pr.comm, pr.container.Name())
+	// use shell's builtin kill, images may not have kill binary,
+	// signal and pid are passed as arguments, not in the script
+	_, err = pr.container.exec(ctx, "sh", "-c", `kill -s "$1" "$2"`, "sh", strings.TrimPrefix(signal, "SIG"), pr.pid)
+	return err
+}
@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// SlowdownConfig configures resource limits set by the slowdown
+	// operation. Zero values leave corresponding limits untouched.
+	SlowdownConfig struct {
+		// CPUs is number of CPUs container can use
+		CPUs float64
+		// CPUShares is relative CPU weight
+		CPUShares int64
+		// MemoryMB is memory limit. It is only lowered for containers
+		// that already have a limit, as docker can't remove the limit
+		// to restore unlimited memory.
+		MemoryMB int
+		// BlkioWeight is relative block IO weight (10-1000)
+		BlkioWeight uint16
+	}
+
+	// slowedResources holds limits of slowed down container
+	slowedResources struct {
+		original container.Resources
+		applied  container.Resources
+	}
+)
+
+// Slowdown is used by the slowdown operation
+var Slowdown = SlowdownConfig{
+	CPUs: 0.1,
+}
+
+const cpuPeriod = 100000
+
+// slowdown lowers container's resource limits for FaultDuration,
+// restoring the original values afterwards
+func (dc *dockerContainer) slowdown(ctx context.Context, operation model.Operation) error {
+	client, err := dc.getClient()
+	if err != nil {
+		return err
+	}
+	info, err := client.ContainerInspect(ctx, dc.container.ID)
+	if err != nil {
+		return err
+	}
+	cfg := Slowdown
+	cfg.CPUs = operation.Float(model.ParamCPUs.Name, cfg.CPUs)
+	cfg.MemoryMB = operation.Int(model.ParamMemory.Name, cfg.MemoryMB)
+	duration := operation.Duration(model.ParamDuration.Name, FaultDuration)
+	original := info.HostConfig.Resources
+	update := container.Resources{}
+	if cfg.CPUs > 0 {
+		if original.NanoCPUs > 0 {
+			// quota can't be changed if container was created with --cpus
+			update.NanoCPUs = int64(cfg.CPUs * 1e9)
+		} else {
+			update.CPUPeriod = cpuPeriod
+			update.CPUQuota = int64(cfg.CPUs * cpuPeriod)
+		}
+	}
+	update.CPUShares = cfg.CPUShares
+	if cfg.MemoryMB > 0 && original.Memory == 0 {
+		glog.Infof("Not limiting memory of container %s, it has no limit to restore", dc.Name())
+	} else if cfg.MemoryMB > 0 {
+		update.Memory = int64(cfg.MemoryMB) * mb
+		update.MemorySwap = -1
+	}
+	update.BlkioWeight = cfg.BlkioWeight
+	if update.NanoCPUs == 0 && update.CPUQuota == 0 && update.CPUShares == 0 && update.Memory == 0 && update.BlkioWeight == 0 {
+		return fmt.Errorf("Nothing to slow down in container %s", dc.Name())
+	}
+
+	dc.dp.mu.Lock()
+	if _, has := dc.dp.savedResources[dc.container.ID]; has {
+		dc.dp.mu.Unlock()
+		glog.Infof("Container %s is already slowed down", dc.Name())
+		return nil
+	}
+	dc.dp.savedResources[dc.container.ID] = slowedResources{
+		original: original,
+		applied:  update,
+	}
+	dc.dp.mu.Unlock()
+
+	glog.Infof("Slowing down container %s for %s", dc.Name(), duration)
+	_, err = client.ContainerUpdate(ctx, dc.container.ID, container.UpdateConfig{Resources: update})
+	if err != nil {
+		dc.dp.mu.Lock()
+		delete(dc.dp.savedResources, dc.container.ID)
+		dc.dp.mu.Unlock()
+		return err
+	}
+	time.AfterFunc(duration, func() {
+		// not bound to ctx, fault should be reverted anyway
+		if err := dc.restoreResources(context.Background()); err != nil {
+			glog.Errorf("Error restoring resources of container %s: %v", dc.Name(), err)
+		}
+	})
+	return nil
+}
+
+// isSlowedDown returns true if container's limits are lowered by slowdown
+func (dc *dockerContainer) isSlowedDown() bool {
+	dc.dp.mu.Lock()
+	defer dc.dp.mu.Unlock()
+	_, has := dc.dp.savedResources[dc.container.ID]
+	return has
+}
+
+// restoreResources sets container's resource limits back to the
+// values they had before slowdown
+func (dc *dockerContainer) restoreResources(ctx context.Context) error {
+	client, err := dc.getClient()
+	if err != nil {
+		return err
+	}
+	dc.dp.mu.Lock()
+	saved, has := dc.dp.savedResources[dc.container.ID]
+	delete(dc.dp.savedResources, dc.container.ID)
+	dc.dp.mu.Unlock()
+	if !has {
+		return nil
+	}
+	original, applied := saved.original, saved.applied
+	// zero values are ignored by the update, so unlimited
+	// values should be restored explicitly
+	restore := container.Resources{}
+	if applied.NanoCPUs > 0 {
+		restore.NanoCPUs = original.NanoCPUs
+	}
+	if applied.CPUQuota > 0 {
+		restore.CPUPeriod = original.CPUPeriod
+		if restore.CPUPeriod == 0 {
+			restore.CPUPeriod = cpuPeriod
+		}
+		restore.CPUQuota = original.CPUQuota
+		if restore.CPUQuota == 0 {
+			restore.CPUQuota = -1
+		}
+	}
+	if applied.CPUShares > 0 {
+		restore.CPUShares = original.CPUShares
+		if restore.CPUShares == 0 {
+			restore.CPUShares = 1024
+		}
+	}
+	if applied.Memory > 0 {
+		// memory is only lowered if it was limited
+		restore.Memory = original.Memory
+		restore.MemorySwap = original.MemorySwap
+		if restore.MemorySwap == 0 {
+			restore.MemorySwap = -1
+		}
+	}
+	if applied.BlkioWeight > 0 {
+		restore.BlkioWeight = original.BlkioWeight
+		if restore.BlkioWeight == 0 {
+			restore.BlkioWeight = 500
+		}
+	}
+	glog.Infof("Restoring resources of container %s", dc.Name())
+	_, err = client.ContainerUpdate(ctx, dc.container.ID, container.UpdateConfig{Resources: restore})
+	return err
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// StressConfig configures resource stress operations
+	StressConfig struct {
+		// CPUs is number of cores to burn
+		CPUs int
+		// MemoryMB is amount of memory to allocate
+		MemoryMB int
+		// DiskPath is directory inside container to fill
+		DiskPath string
+		// DiskMB is size of the file to fill DiskPath with
+		DiskMB int
+	}
+)
+
+// Stress is used by the stress operations
+var Stress = StressConfig{
+	CPUs:     1,
+	MemoryMB: 256,
+	DiskPath: "/tmp",
+	DiskMB:   1024,
+}
+
+const mb = 1024 * 1024
+
+// stress injects resource pressure into the container for FaultDuration,
+// or for duration parameter of the operation.
+// Pressure is created by the shell script exec'd inside container,
+// which cleans up after itself when duration ends.
+func (dc *dockerContainer) stress(ctx context.Context, operation model.Operation) error {
+	cmd, err := stressCommand(operation)
+	if err != nil {
+		return err
+	}
+	return dc.execDetached(ctx, cmd...)
+}
+
+// stressCommand returns command running the stress script of the operation.
+// Fractional number of CPUs is rounded up, as cores are burnt whole.
+func stressCommand(operation model.Operation) ([]string, error) {
+	var script string
+	var args []string
+	seconds := int(operation.Duration(model.ParamDuration.Name, FaultDuration).Seconds())
+	cfg := Stress
+	cfg.CPUs = int(math.Ceil(operation.Float(model.ParamCPUs.Name, float64(cfg.CPUs))))
+	cfg.MemoryMB = operation.Int(model.ParamMemory.Name, cfg.MemoryMB)
+	cfg.DiskMB = operation.Int(model.ParamDisk.Name, cfg.DiskMB)
+	switch operation.Type {
+	case model.OperationTypeStressCPU:
+		script = fmt.Sprintf(`pids=""; i=0; while [ $i -lt %d ]; do (while :; do :; done) & pids="$pids $!"; i=$((i+1)); done; trap 'kill $pids' EXIT INT TERM; sleep %d`,
+			cfg.CPUs, seconds)
+	case model.OperationTypeStressMemory:
+		// tail keeps whole input in memory until it gets EOF
+		script = fmt.Sprintf(`(head -c %d /dev/zero; sleep %d) | tail > /dev/null`,
+			cfg.MemoryMB*mb, seconds)
+	case model.OperationTypeStressDisk:
+		// path is passed as argument, so it isn't interpreted by the shell
+		script = fmt.Sprintf(`f="$1/.chaos-fill-$$"; trap 'rm -f "$f"' EXIT INT TERM; head -c %d /dev/zero > "$f"; sleep %d`,
+			cfg.DiskMB*mb, seconds)
+		args = []string{cfg.DiskPath}
+	default:
+		return nil, model.ErrOperationNotSupported
+	}
+	return append([]string{"sh", "-c", script, "sh"}, args...), nil
+}
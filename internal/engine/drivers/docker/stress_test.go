@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+func TestStressCommand(t *testing.T) {
+	tests := []struct {
+		op model.Operation
+		// want is substring of the script
+		want string
+	}{
+		{op: model.Operation{Type: model.OperationTypeStressCPU, Params: map[string]string{"cpus": "0.5"}}, want: "-lt 1 ]"},
+		{op: model.Operation{Type: model.OperationTypeStressCPU, Params: map[string]string{"cpus": "2"}}, want: "-lt 2 ]"},
+		{op: model.Operation{Type: model.OperationTypeStressCPU, Params: map[string]string{"cpus": "2.1"}}, want: "-lt 3 ]"},
+		{op: model.Operation{Type: model.OperationTypeStressMemory, Params: map[string]string{"memory_mb": "2"}}, want: "head -c 2097152"},
+	}
+	for _, tt := range tests {
+		cmd, err := stressCommand(tt.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(cmd[2], tt.want) {
+			t.Errorf("%s %v: script %s, want %s in it", tt.op.Type, tt.op.Params, cmd[2], tt.want)
+		}
+	}
+	if _, err := stressCommand(model.NewOperation(model.OperationTypePause)); err != model.ErrOperationNotSupported {
+		t.Errorf("Pause: error %v, want %v", err, model.ErrOperationNotSupported)
+	}
+}
+
+// TestStressDisk runs disk stress script locally on the
+// path that would run commands if it was interpreted by the shell
+func TestStressDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a b;touch injected")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(cfg StressConfig) { Stress = cfg }(Stress)
+	Stress.DiskPath = path
+	cmd, err := stressCommand(model.Operation{Type: model.OperationTypeStressDisk, Params: map[string]string{"disk_mb": "1", "duration": "1s"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := exec.Command(cmd[0], cmd[1:]...)
+	c.Dir = dir
+	if out, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("Script failed: %v %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "injected")); err == nil {
+		t.Errorf("Path is interpreted by the shell")
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("%d files left in %s after the stress", len(files), path)
+	}
+}
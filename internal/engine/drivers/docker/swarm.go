@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/golang/glog"
+)
+
+type (
+	// swarmCache keeps nodes, services and tasks of the swarm, so they
+	// don't have to be listed on every Entities call. They are listed
+	// again after SwarmRefreshInterval, or earlier if they are known
+	// to have changed.
+	swarmCache struct {
+		nodes []swarm.Node
+		// serviceNames are names of the services by id
+		serviceNames map[string]string
+		// tasks that should be running
+		tasks []swarm.Task
+		// refreshed is time of the last listing, zero if
+		// cache should be refreshed on the next use
+		refreshed time.Time
+	}
+)
+
+// SwarmRefreshInterval is how long nodes, services and tasks are cached
+var SwarmRefreshInterval = 10 * time.Second
+
+// refreshSwarm lists nodes, services and tasks of the swarm if cache
+// is older than SwarmRefreshInterval, or always if force is true.
+// If listing fails, cache is kept and listing is retried after the interval.
+func (dp *DockerPlayground) refreshSwarm(force bool) {
+	dp.mu.Lock()
+	refreshed := dp.cluster.refreshed
+	dp.mu.Unlock()
+	if !force && !refreshed.IsZero() && time.Since(refreshed) < SwarmRefreshInterval {
+		return
+	}
+	ctx := context.Background()
+	nodes, err := dp.client.NodeList(ctx, types.NodeListOptions{})
+	if err != nil {
+		glog.Infof("Error getting nodes list: %v", err)
+		dp.setSwarmRefreshed()
+		return
+	}
+	services, err := dp.client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		glog.Infof("Error getting services list: %v", err)
+		dp.setSwarmRefreshed()
+		return
+	}
+	tasks, err := dp.client.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("desired-state", string(swarm.TaskStateRunning))),
+	})
+	if err != nil {
+		glog.Infof("Error getting tasks list: %v", err)
+		dp.setSwarmRefreshed()
+		return
+	}
+	serviceNames := make(map[string]string, len(services))
+	for _, service := range services {
+		serviceNames[service.ID] = service.Spec.Name
+	}
+	dp.mu.Lock()
+	dp.cluster = swarmCache{
+		nodes:        nodes,
+		serviceNames: serviceNames,
+		tasks:        tasks,
+		refreshed:    time.Now(),
+	}
+	dp.mu.Unlock()
+	hostnames := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		glog.V(2).Infof("Node %s has id %s\n", node.Description.Hostname, node.ID)
+		hostnames = append(hostnames, node.Description.Hostname)
+	}
+	dp.pool.sync(hostnames)
+}
+
+// setSwarmRefreshed marks cache refreshed without changing it,
+// so failing swarm API isn't asked on every call
+func (dp *DockerPlayground) setSwarmRefreshed() {
+	dp.mu.Lock()
+	dp.cluster.refreshed = time.Now()
+	dp.mu.Unlock()
+}
+
+// invalidateSwarm makes cache refreshed on the next use
+func (dp *DockerPlayground) invalidateSwarm() {
+	dp.mu.Lock()
+	dp.cluster.refreshed = time.Time{}
+	dp.mu.Unlock()
+}
+
+func (dp *DockerPlayground) getNodes() []swarm.Node {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	return dp.cluster.nodes
+}
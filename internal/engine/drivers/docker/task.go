@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// dockerTask is a swarm service task, links node with container
+	// that runs the task
+	dockerTask struct {
+		task        swarm.Task
+		serviceName string
+		dp          *DockerPlayground
+		parent      model.Entity
+		childs      []model.Entity
+	}
+)
+
+// swarmTasks returns cached tasks of all services, keyed by task id,
+// attached to their nodes
+func (dp *DockerPlayground) swarmTasks(nodes map[string]*dockerNode) map[string]*dockerTask {
+	dp.mu.Lock()
+	tasks, serviceNames := dp.cluster.tasks, dp.cluster.serviceNames
+	dp.mu.Unlock()
+	res := make(map[string]*dockerTask, len(tasks))
+	for _, task := range tasks {
+		dt := &dockerTask{
+			task:        task,
+			serviceName: serviceNames[task.ServiceID],
+			dp:          dp,
+		}
+		if dn, has := nodes[task.NodeID]; has {
+			dt.parent = dn
+			dn.childs = append(dn.childs, dt)
+		}
+		res[task.ID] = dt
+	}
+	return res
+}
+
+func (dt *dockerTask) ID() string {
+	return dt.task.ID
+}
+
+// Name returns name of the task the same way as Docker does
+// for its containers: service.slot for replicated services
+// and service.node for global ones
+func (dt *dockerTask) Name() string {
+	if dt.task.Slot != 0 {
+		return fmt.Sprintf("%s.%d", dt.serviceName, dt.task.Slot)
+	}
+	return fmt.Sprintf("%s.%s", dt.serviceName, dt.task.NodeID)
+}
+
+func (dt *dockerTask) Labels() map[string]string {
+	labels := make(map[string]string)
+	for k, v := range dt.task.Labels {
+		labels[k] = v
+	}
+	if dt.task.Spec.ContainerSpec != nil {
+		for k, v := range dt.task.Spec.ContainerSpec.Labels {
+			labels[k] = v
+		}
+	}
+	labels[swarmServiceIDLabel] = dt.task.ServiceID
+	labels[swarmServiceNameLabel] = dt.serviceName
+	labels[swarmTaskIDLabel] = dt.task.ID
+	labels[swarmNodeIDLabel] = dt.task.NodeID
+	return labels
+}
+
+func (dt *dockerTask) Parent() model.Entity {
+	return dt.parent
+}
+
+// Childs returns containers of the task
+func (dt *dockerTask) Childs() []model.Entity {
+	return dt.childs
+}
+
+func (dt *dockerTask) Type() model.EntityType {
+	return model.EntityTypeTask
+}
+
+// Do is not supported for tasks, operations should be done
+// on the task's container or node
+func (dt *dockerTask) Do(ctx context.Context, operation model.Operation) error {
+	return model.ErrOperationNotSupported
+}
+
+func (dt *dockerTask) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := dt.status(ctx)
+	return status, classifyError(err)
+}
+
+func (dt *dockerTask) status(ctx context.Context) (model.StatusType, error) {
+	task, _, err := dt.dp.client.TaskInspectWithRaw(ctx, dt.task.ID)
+	if err != nil {
+		return 0, err
+	}
+	switch task.Status.State {
+	case swarm.TaskStateShutdown, swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateRejected, swarm.TaskStateRemove, swarm.TaskStateOrphaned:
+		return model.StatusTypeDestroyed, nil
+	}
+	return model.StatusTypeWorking, nil
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// ThrottleConfig configures bandwidth throttling
+	ThrottleConfig struct {
+		// Rate in tc format, like 1mbit or 500kbit
+		Rate string
+		// Egress limits outgoing traffic
+		Egress bool
+		// Ingress limits incoming traffic
+		Ingress bool
+	}
+)
+
+// Throttle is used by the throttle operation
+var Throttle = ThrottleConfig{
+	Rate:    "1mbit",
+	Egress:  true,
+	Ingress: true,
+}
+
+// ParseThrottleDirection returns which of egress and
+// ingress is throttled by direction egress, ingress or both
+func ParseThrottleDirection(direction string) (egress, ingress bool, err error) {
+	switch direction {
+	case "egress":
+		return true, false, nil
+	case "ingress":
+		return false, true, nil
+	case "both":
+		return true, true, nil
+	}
+	return false, false, fmt.Errorf("Bad throttle direction %q, should be egress, ingress or both", direction)
+}
+
+var tcRateRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([kmgt]?bit|[kmgt]?bps)$`)
+
+// forEachInterface runs command for each network interface except loopback,
+// $i is name of the interface
+func forEachInterface(cmd string) string {
+	return fmt.Sprintf(`for i in $(ls /sys/class/net); do [ $i = lo ] && continue; %s; done`, cmd)
+}
+
+// throttle caps bandwidth of the container for FaultDuration.
+// Egress traffic is shaped by token bucket filter, ingress
+// traffic is policed, so ifb module is not needed.
+func (dc *dockerContainer) throttle(ctx context.Context, operation model.Operation) error {
+	rate := operation.Param(model.ParamRate.Name, Throttle.Rate)
+	if !tcRateRegexp.MatchString(rate) {
+		return fmt.Errorf("Bad throttle rate %q", rate)
+	}
+	if !Throttle.Egress && !Throttle.Ingress {
+		return fmt.Errorf("Neither egress nor ingress throttling is enabled")
+	}
+	var apply, revert []string
+	if Throttle.Egress {
+		apply = append(apply, forEachInterface(fmt.Sprintf("tc qdisc add dev $i root tbf rate %s burst 64kb latency 400ms", rate)))
+		revert = append(revert, forEachInterface("tc qdisc del dev $i root"))
+	}
+	if Throttle.Ingress {
+		apply = append(apply, forEachInterface(fmt.Sprintf("tc qdisc add dev $i handle ffff: ingress && tc filter add dev $i parent ffff: protocol all u32 match u32 0 0 police rate %s burst 64kb drop flowid :1", rate)))
+		revert = append(revert, forEachInterface("tc qdisc del dev $i handle ffff: ingress"))
+	}
+	return dc.runNetworkHelper(ctx, operation.Duration(model.ParamDuration.Name, FaultDuration), strings.Join(apply, "; "), strings.Join(revert, "; "))
+}
@@ -0,0 +1,28 @@
+package docker
+
+import "testing"
+
+func TestParseThrottleDirection(t *testing.T) {
+	tests := []struct {
+		direction string
+		egress    bool
+		ingress   bool
+		wantErr   bool
+	}{
+		{direction: "egress", egress: true},
+		{direction: "ingress", ingress: true},
+		{direction: "both", egress: true, ingress: true},
+		{direction: "out", wantErr: true},
+		{direction: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		egress, ingress, err := ParseThrottleDirection(tt.direction)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, want error %v", tt.direction, err, tt.wantErr)
+			continue
+		}
+		if egress != tt.egress || ingress != tt.ingress {
+			t.Errorf("%q: egress %v, ingress %v, want %v, %v", tt.direction, egress, ingress, tt.egress, tt.ingress)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// newUndo returns undo calling f, with errors classified
+func newUndo(what string, f func(ctx context.Context) error) model.Undo {
+	return model.NewUndo(what, func(ctx context.Context) error {
+		return classifyError(f(ctx))
+	})
+}
+
+// DoReversible does operation, returning handle that reverts it
+func (dc *dockerContainer) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := dc.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	return dc.undo(operation), nil
+}
+
+// undo returns handle reverting operation done on the container, nil
+// if it can't be reverted. Stopped and killed containers are not started
+// back, as swarm replaces them with new ones. Network faults are reverted
+// all at once, as they are when resumed.
+func (dc *dockerContainer) undo(operation model.Operation) model.Undo {
+	switch operation.Type {
+	case model.OperationTypePause:
+		return newUndo("unpause", func(ctx context.Context) error {
+			client, err := dc.getClient()
+			if err != nil {
+				return err
+			}
+			return client.ContainerUnpause(ctx, dc.container.ID)
+		})
+	case model.OperationTypeSlowdown:
+		return newUndo("restore resources", dc.restoreResources)
+	case model.OperationTypeBlackhole:
+		return newUndo("stop network helpers and restore hosts", dc.unblackhole)
+	case model.OperationTypeThrottle:
+		return newUndo("stop network helpers", dc.stopNetworkHelpers)
+	case model.OperationTypeSkewClock:
+		return newUndo("reset clock", dc.resetClock)
+	}
+	return nil
+}
+
+// DoReversible does operation, returning handle that reverts it
+func (dn *dockerNode) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := dn.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	switch operation.Type {
+	case model.OperationTypePause, model.OperationTypeDrain:
+		return newUndo("restore availability", dn.restoreAvailability), nil
+	}
+	return nil, nil
+}
+
+// DoReversible does operation, returning handle that reverts it
+func (pr *dockerProcess) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := pr.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	if operation.Type == model.OperationTypePause {
+		return newUndo("continue", func(ctx context.Context) error {
+			return pr.signal(ctx, "SIGCONT")
+		}), nil
+	}
+	return nil, nil
+}
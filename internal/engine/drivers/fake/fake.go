@@ -0,0 +1,526 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// EntityConfig describes entity of the fake playground
+	EntityConfig struct {
+		ID     string            `json:"id"`
+		Name   string            `json:"name"`
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels,omitempty"`
+		// Parent is id of the parent entity
+		Parent string `json:"parent,omitempty"`
+		// Status entity starts in, working if empty
+		Status string `json:"status,omitempty"`
+		// Operations entity supports, all if empty
+		Operations []string `json:"operations,omitempty"`
+		// Transitions maps operation to status entity gets after it,
+		// overriding the default ones
+		Transitions map[string]string `json:"transitions,omitempty"`
+		// Errors maps operation (or "status") to error it returns,
+		// message prefixed with "transient: " or "gone: " gives
+		// error of that class. Undo returns error of resume.
+		Errors map[string]string `json:"errors,omitempty"`
+		// Latency of the entity's operations, e.g. 100ms
+		Latency string `json:"latency,omitempty"`
+		// RecoverAfter is how long entity stays affected by an operation
+		// before it is working again, e.g. 5m, forever if empty.
+		// Duration parameter of the operation overrides it.
+		RecoverAfter string `json:"recover_after,omitempty"`
+	}
+
+	// Call is a record of the operation done on an entity
+	Call struct {
+		Time      time.Time
+		EntityID  string
+		Name      string
+		Operation model.Operation
+		// Undo is true if operation was reverted by the call
+		Undo bool
+		Err  error
+	}
+
+	// FakePlayground keeps entities in memory, changing their
+	// statuses on operations and recording all the operations done.
+	// Destroyed entities and their descendants are not listed,
+	// same as the real playgrounds do.
+	FakePlayground struct {
+		mu       sync.Mutex
+		clock    model.Clock
+		entities []*fakeEntity
+		byID     map[string]*fakeEntity
+		calls    []Call
+		// latency of all the listings and operations
+		latency     time.Duration
+		entitiesErr error
+	}
+
+	fakeEntity struct {
+		fp          *FakePlayground
+		id          string
+		name        string
+		etype       model.EntityType
+		labels      map[string]string
+		parent      *fakeEntity
+		childs      []*fakeEntity
+		status      model.StatusType
+		operations  map[model.OperationType]bool
+		transitions map[model.OperationType]model.StatusType
+		errors      map[model.OperationType]error
+		statusErr   error
+		latency     time.Duration
+		recoverIn   time.Duration
+		// recoverAt is time entity is working again, zero if never
+		recoverAt time.Time
+	}
+)
+
+// statusKey is key of the Errors config which sets error of Status
+const statusKey = "status"
+
+// configError makes error from the message of the Errors config
+func configError(msg string) error {
+	switch {
+	case strings.HasPrefix(msg, "transient: "):
+		return model.TransientError(errors.New(strings.TrimPrefix(msg, "transient: ")))
+	case strings.HasPrefix(msg, "gone: "):
+		return model.GoneError(errors.New(strings.TrimPrefix(msg, "gone: ")))
+	}
+	return errors.New(msg)
+}
+
+// defaultTransitions are statuses entities get after operations,
+// operations not listed don't change status
+var defaultTransitions = map[model.OperationType]model.StatusType{
+	model.OperationTypeDestroy:      model.StatusTypeDestroyed,
+	model.OperationTypeStart:        model.StatusTypeWorking,
+	model.OperationTypeStop:         model.StatusTypeStopped,
+	model.OperationTypePause:        model.StatusTypePaused,
+	model.OperationTypeResume:       model.StatusTypeWorking,
+	model.OperationTypeSlowdown:     model.StatusTypeSlow,
+	model.OperationTypeDrain:        model.StatusTypePaused,
+	model.OperationTypeKill:         model.StatusTypeStopped,
+	model.OperationTypeRestart:      model.StatusTypeWorking,
+	model.OperationTypeStressCPU:    model.StatusTypeSlow,
+	model.OperationTypeStressMemory: model.StatusTypeSlow,
+	model.OperationTypeStressDisk:   model.StatusTypeSlow,
+	model.OperationTypeBlackhole:    model.StatusTypeSlow,
+	model.OperationTypeThrottle:     model.StatusTypeSlow,
+	model.OperationTypeSkewClock:    model.StatusTypeSlow,
+	model.OperationTypeTimeout:      model.StatusTypeSlow,
+	model.OperationTypeSlice:        model.StatusTypeSlow,
+	model.OperationTypeScaleDown:    model.StatusTypeSlow,
+}
+
+// LoadConfig reads entities configs from JSON file
+func LoadConfig(path string) ([]EntityConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]EntityConfig, 0)
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return configs, nil
+}
+
+// NewFakePlayground creates a new fake driver with the entities.
+// Parents should be listed before their childs.
+func NewFakePlayground(configs []EntityConfig) (*FakePlayground, error) {
+	fp := &FakePlayground{
+		clock: model.RealClock,
+		byID:  make(map[string]*fakeEntity),
+	}
+	for i := range configs {
+		fe, err := fp.newEntity(&configs[i])
+		if err != nil {
+			return nil, err
+		}
+		fp.entities = append(fp.entities, fe)
+		fp.byID[fe.id] = fe
+	}
+	return fp, nil
+}
+
+func (fp *FakePlayground) newEntity(config *EntityConfig) (*fakeEntity, error) {
+	if config.ID == "" {
+		return nil, fmt.Errorf("Entity %q has no id", config.Name)
+	}
+	if _, has := fp.byID[config.ID]; has {
+		return nil, fmt.Errorf("Entity %s is listed twice", config.ID)
+	}
+	etype, err := model.ParseEntityType(config.Type)
+	if err != nil {
+		return nil, fmt.Errorf("Entity %s: %v", config.ID, err)
+	}
+	fe := &fakeEntity{
+		fp:          fp,
+		id:          config.ID,
+		name:        config.Name,
+		etype:       etype,
+		labels:      config.Labels,
+		status:      model.StatusTypeWorking,
+		transitions: make(map[model.OperationType]model.StatusType),
+		errors:      make(map[model.OperationType]error),
+	}
+	if fe.labels == nil {
+		fe.labels = make(map[string]string)
+	}
+	if config.Parent != "" {
+		parent, has := fp.byID[config.Parent]
+		if !has {
+			return nil, fmt.Errorf("Parent %s of entity %s is not listed before it", config.Parent, config.ID)
+		}
+		fe.parent = parent
+		parent.childs = append(parent.childs, fe)
+	}
+	if config.Status != "" {
+		if fe.status, err = model.ParseStatusType(config.Status); err != nil {
+			return nil, fmt.Errorf("Entity %s: %v", config.ID, err)
+		}
+	}
+	if len(config.Operations) > 0 {
+		fe.operations = make(map[model.OperationType]bool)
+		for _, name := range config.Operations {
+			op, err := model.ParseOperationType(name)
+			if err != nil {
+				return nil, fmt.Errorf("Entity %s: %v", config.ID, err)
+			}
+			fe.operations[op] = true
+		}
+	}
+	for name, statusName := range config.Transitions {
+		op, err := model.ParseOperationType(name)
+		if err != nil {
+			return nil, fmt.Errorf("Entity %s: %v", config.ID, err)
+		}
+		if fe.transitions[op], err = model.ParseStatusType(statusName); err != nil {
+			return nil, fmt.Errorf("Entity %s: %v", config.ID, err)
+		}
+	}
+	for name, msg := range config.Errors {
+		if name == statusKey {
+			fe.statusErr = configError(msg)
+			continue
+		}
+		op, err := model.ParseOperationType(name)
+		if err != nil {
+			return nil, fmt.Errorf("Entity %s: %v", config.ID, err)
+		}
+		fe.errors[op] = configError(msg)
+	}
+	if config.Latency != "" {
+		if fe.latency, err = time.ParseDuration(config.Latency); err != nil {
+			return nil, fmt.Errorf("Bad latency of entity %s: %v", config.ID, err)
+		}
+	}
+	if config.RecoverAfter != "" {
+		if fe.recoverIn, err = time.ParseDuration(config.RecoverAfter); err != nil {
+			return nil, fmt.Errorf("Bad recover_after of entity %s: %v", config.ID, err)
+		}
+	}
+	return fe, nil
+}
+
+// Capabilities returns operations entities support, all of them
+// taking the standard parameters
+func (fp *FakePlayground) Capabilities() []model.OperationSpec {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	entities := make(map[model.OperationType]map[model.EntityType]bool)
+	add := func(op model.OperationType, et model.EntityType) {
+		if entities[op] == nil {
+			entities[op] = make(map[model.EntityType]bool)
+		}
+		entities[op][et] = true
+	}
+	for _, fe := range fp.entities {
+		if fe.operations != nil {
+			for op := range fe.operations {
+				add(op, fe.etype)
+			}
+			continue
+		}
+		for op := range defaultTransitions {
+			add(op, fe.etype)
+		}
+	}
+	res := make([]model.OperationSpec, 0, len(entities))
+	for op, types := range entities {
+		spec := model.OperationSpec{Operation: op, Params: model.StandardParams}
+		for et := range types {
+			spec.Entities = append(spec.Entities, et)
+		}
+		sort.Slice(spec.Entities, func(i, j int) bool { return spec.Entities[i] < spec.Entities[j] })
+		res = append(res, spec)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Operation < res[j].Operation })
+	return res
+}
+
+// Entities returns entities that are not destroyed
+func (fp *FakePlayground) Entities() ([]model.Entity, error) {
+	fp.mu.Lock()
+	clock, latency, err := fp.clock, fp.latency, fp.entitiesErr
+	fp.mu.Unlock()
+	<-clock.After(latency)
+	if err != nil {
+		return nil, err
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.recover()
+	res := make([]model.Entity, 0, len(fp.entities))
+	for _, fe := range fp.entities {
+		if fe.listed() {
+			res = append(res, fe)
+		}
+	}
+	return res, nil
+}
+
+// SetClock sets clock used for latencies, recoveries and
+// calls' times, so virtual time can be used in simulations
+func (fp *FakePlayground) SetClock(clock model.Clock) {
+	fp.mu.Lock()
+	fp.clock = clock
+	fp.mu.Unlock()
+}
+
+// recover makes entities which recovery time has come working
+func (fp *FakePlayground) recover() {
+	now := fp.clock.Now()
+	for _, fe := range fp.entities {
+		if !fe.recoverAt.IsZero() && !now.Before(fe.recoverAt) {
+			glog.Infof("Fake %s %s recovered", fe.etype, fe.name)
+			fe.status = model.StatusTypeWorking
+			fe.recoverAt = time.Time{}
+		}
+	}
+}
+
+// SetLatency sets latency of all the listings and operations
+func (fp *FakePlayground) SetLatency(latency time.Duration) {
+	fp.mu.Lock()
+	fp.latency = latency
+	fp.mu.Unlock()
+}
+
+// SetEntitiesError makes Entities return err, nil clears the error
+func (fp *FakePlayground) SetEntitiesError(err error) {
+	fp.mu.Lock()
+	fp.entitiesErr = err
+	fp.mu.Unlock()
+}
+
+// SetError makes operation on entity return err, nil clears the error
+func (fp *FakePlayground) SetError(id string, operation model.OperationType, err error) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fe, has := fp.byID[id]
+	if !has {
+		return fmt.Errorf("No entity %s", id)
+	}
+	if err == nil {
+		delete(fe.errors, operation)
+	} else {
+		fe.errors[operation] = err
+	}
+	return nil
+}
+
+// SetStatus sets status of the entity. Setting destroyed entity
+// working brings it back to the list.
+func (fp *FakePlayground) SetStatus(id string, status model.StatusType) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fe, has := fp.byID[id]
+	if !has {
+		return fmt.Errorf("No entity %s", id)
+	}
+	fe.status = status
+	fe.recoverAt = time.Time{}
+	return nil
+}
+
+// Calls returns all the operations done since creation or last ResetCalls
+func (fp *FakePlayground) Calls() []Call {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return append([]Call(nil), fp.calls...)
+}
+
+// ResetCalls clears record of the operations done
+func (fp *FakePlayground) ResetCalls() {
+	fp.mu.Lock()
+	fp.calls = nil
+	fp.mu.Unlock()
+}
+
+// listed returns true if neither entity nor its ancestors are destroyed
+func (fe *fakeEntity) listed() bool {
+	for p := fe; p != nil; p = p.parent {
+		if p.status == model.StatusTypeDestroyed {
+			return false
+		}
+	}
+	return true
+}
+
+func (fe *fakeEntity) ID() string {
+	return fe.id
+}
+
+func (fe *fakeEntity) Name() string {
+	return fe.name
+}
+
+func (fe *fakeEntity) Labels() map[string]string {
+	return fe.labels
+}
+
+func (fe *fakeEntity) Parent() model.Entity {
+	if fe.parent == nil {
+		return nil
+	}
+	return fe.parent
+}
+
+// Childs returns childs that are not destroyed
+func (fe *fakeEntity) Childs() []model.Entity {
+	fe.fp.mu.Lock()
+	defer fe.fp.mu.Unlock()
+	fe.fp.recover()
+	res := make([]model.Entity, 0, len(fe.childs))
+	for _, c := range fe.childs {
+		if c.status != model.StatusTypeDestroyed {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (fe *fakeEntity) Type() model.EntityType {
+	return fe.etype
+}
+
+// Do waits for the latency and does operation, operation is not
+// done if ctx is done first, the call is recorded anyway
+func (fe *fakeEntity) Do(ctx context.Context, operation model.Operation) error {
+	_, err := fe.DoReversible(ctx, operation)
+	return err
+}
+
+// DoReversible does operation same as Do, undo sets status entity had
+// before the operation. Destroy can't be undone.
+func (fe *fakeEntity) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	fe.fp.mu.Lock()
+	clock, latency := fe.fp.clock, fe.fp.latency+fe.latency
+	fe.fp.mu.Unlock()
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-clock.After(latency):
+	}
+
+	fe.fp.mu.Lock()
+	defer fe.fp.mu.Unlock()
+	prev := fe.status
+	if err == nil {
+		fe.fp.recover()
+		prev = fe.status
+		err = fe.do(operation)
+	}
+	fe.fp.calls = append(fe.fp.calls, Call{
+		Time:      clock.Now(),
+		EntityID:  fe.id,
+		Name:      fe.name,
+		Operation: operation,
+		Err:       err,
+	})
+	glog.Infof("Fake %s of %s %s: %v", operation, fe.etype, fe.name, err)
+	if err != nil || operation.Type == model.OperationTypeDestroy {
+		return nil, err
+	}
+	return model.NewUndo("set "+prev.String(), func(ctx context.Context) error {
+		return fe.undo(operation, prev)
+	}), nil
+}
+
+// undo sets status back, recording the call
+func (fe *fakeEntity) undo(operation model.Operation, status model.StatusType) error {
+	fe.fp.mu.Lock()
+	defer fe.fp.mu.Unlock()
+	fe.fp.recover()
+	var err error
+	if err = fe.errors[model.OperationTypeResume]; err == nil {
+		if fe.listed() {
+			fe.status = status
+			fe.recoverAt = time.Time{}
+		} else {
+			err = model.GoneError(fmt.Errorf("Entity %s is destroyed", fe.name))
+		}
+	}
+	fe.fp.calls = append(fe.fp.calls, Call{
+		Time:      fe.fp.clock.Now(),
+		EntityID:  fe.id,
+		Name:      fe.name,
+		Operation: operation,
+		Undo:      true,
+		Err:       err,
+	})
+	glog.Infof("Fake undo of %s of %s %s: %v", operation, fe.etype, fe.name, err)
+	return err
+}
+
+func (fe *fakeEntity) do(operation model.Operation) error {
+	if fe.operations != nil && !fe.operations[operation.Type] {
+		return model.ErrOperationNotSupported
+	}
+	if err := fe.errors[operation.Type]; err != nil {
+		return err
+	}
+	if !fe.listed() {
+		return model.GoneError(fmt.Errorf("Entity %s is destroyed", fe.name))
+	}
+	if status, has := fe.transitions[operation.Type]; has {
+		fe.status = status
+	} else if status, has := defaultTransitions[operation.Type]; has {
+		fe.status = status
+	}
+	fe.recoverAt = time.Time{}
+	recoverIn := operation.Duration(model.ParamDuration.Name, fe.recoverIn)
+	if fe.status != model.StatusTypeWorking && recoverIn > 0 {
+		fe.recoverAt = fe.fp.clock.Now().Add(recoverIn)
+	}
+	return nil
+}
+
+func (fe *fakeEntity) Status(ctx context.Context) (model.StatusType, error) {
+	fe.fp.mu.Lock()
+	defer fe.fp.mu.Unlock()
+	fe.fp.recover()
+	if fe.statusErr != nil {
+		return 0, fe.statusErr
+	}
+	if !fe.listed() {
+		return model.StatusTypeDestroyed, nil
+	}
+	return fe.status, nil
+}
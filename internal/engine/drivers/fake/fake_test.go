@@ -0,0 +1,318 @@
+package fake
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// testClock is a virtual clock moved by Add and by waiting on it,
+	// waits never end when it is stopped
+	testClock struct {
+		mu      sync.Mutex
+		now     time.Time
+		stopped bool
+	}
+)
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	if stopped {
+		return nil
+	}
+	c.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// testConfigs are vm n1 running containers c1 and c2, c1 running process p1
+func testConfigs() []EntityConfig {
+	return []EntityConfig{
+		{ID: "n1", Name: "node1", Type: "vm"},
+		{ID: "c1", Name: "web-1", Type: "container", Parent: "n1", Labels: map[string]string{"app": "web"}},
+		{ID: "p1", Name: "ffmpeg", Type: "process", Parent: "c1"},
+		{ID: "c2", Name: "db-1", Type: "container", Parent: "n1", Operations: []string{"pause", "resume"}},
+	}
+}
+
+// newTestPlayground returns fake playground of the configs on test clock
+func newTestPlayground(t *testing.T, configs []EntityConfig) (*FakePlayground, *testClock) {
+	t.Helper()
+	fp, err := NewFakePlayground(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fp.SetClock(clock)
+	return fp, clock
+}
+
+// listed returns sorted ids of the entities playground lists
+func listed(t *testing.T, fp *FakePlayground) string {
+	t.Helper()
+	entities, err := fp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(entities))
+	for _, e := range entities {
+		ids = append(ids, e.ID())
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func status(t *testing.T, fp *FakePlayground, id string) model.StatusType {
+	t.Helper()
+	status, err := fp.byID[id].Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestNewFakePlayground(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []EntityConfig
+		wantErr bool
+	}{
+		{name: "ok", configs: testConfigs()},
+		{name: "no id", configs: []EntityConfig{{Name: "web-1", Type: "container"}}, wantErr: true},
+		{name: "listed twice", configs: []EntityConfig{{ID: "c1", Type: "container"}, {ID: "c1", Type: "container"}}, wantErr: true},
+		{name: "bad type", configs: []EntityConfig{{ID: "c1", Type: "pod"}}, wantErr: true},
+		{name: "parent after child", configs: []EntityConfig{{ID: "c1", Type: "container", Parent: "n1"}, {ID: "n1", Type: "vm"}}, wantErr: true},
+		{name: "bad status", configs: []EntityConfig{{ID: "c1", Type: "container", Status: "sleepy"}}, wantErr: true},
+		{name: "bad operation", configs: []EntityConfig{{ID: "c1", Type: "container", Operations: []string{"explode"}}}, wantErr: true},
+		{name: "bad transition", configs: []EntityConfig{{ID: "c1", Type: "container", Transitions: map[string]string{"pause": "sleepy"}}}, wantErr: true},
+		{name: "bad error", configs: []EntityConfig{{ID: "c1", Type: "container", Errors: map[string]string{"explode": "boom"}}}, wantErr: true},
+		{name: "bad latency", configs: []EntityConfig{{ID: "c1", Type: "container", Latency: "fast"}}, wantErr: true},
+		{name: "bad recover_after", configs: []EntityConfig{{ID: "c1", Type: "container", RecoverAfter: "soon"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := NewFakePlayground(tt.configs); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOperations(t *testing.T) {
+	tests := []struct {
+		id         string
+		op         model.OperationType
+		wantStatus model.StatusType
+		wantErr    error
+		// wantListed are ids of the entities listed after the operation
+		wantListed string
+	}{
+		{id: "c1", op: model.OperationTypePause, wantStatus: model.StatusTypePaused, wantListed: "c1,c2,n1,p1"},
+		{id: "c1", op: model.OperationTypeStop, wantStatus: model.StatusTypeStopped, wantListed: "c1,c2,n1,p1"},
+		// descendants of destroyed entity are not listed
+		{id: "c1", op: model.OperationTypeDestroy, wantStatus: model.StatusTypeDestroyed, wantListed: "c2,n1"},
+		{id: "n1", op: model.OperationTypeDestroy, wantStatus: model.StatusTypeDestroyed, wantListed: ""},
+		{id: "c2", op: model.OperationTypePause, wantStatus: model.StatusTypePaused, wantListed: "c1,c2,n1,p1"},
+		{id: "c2", op: model.OperationTypeStop, wantStatus: model.StatusTypeWorking, wantErr: model.ErrOperationNotSupported, wantListed: "c1,c2,n1,p1"},
+	}
+	for _, tt := range tests {
+		fp, _ := newTestPlayground(t, testConfigs())
+		err := fp.byID[tt.id].Do(context.Background(), model.NewOperation(tt.op))
+		if err != tt.wantErr {
+			t.Errorf("%s of %s: error %v, want %v", tt.op, tt.id, err, tt.wantErr)
+		}
+		if got := status(t, fp, tt.id); got != tt.wantStatus {
+			t.Errorf("%s of %s: status %s, want %s", tt.op, tt.id, got, tt.wantStatus)
+		}
+		if got := listed(t, fp); got != tt.wantListed {
+			t.Errorf("%s of %s: listed %s, want %s", tt.op, tt.id, got, tt.wantListed)
+		}
+		if calls := fp.Calls(); len(calls) != 1 || calls[0].EntityID != tt.id || calls[0].Operation.Type != tt.op {
+			t.Errorf("%s of %s: calls %+v", tt.op, tt.id, calls)
+		}
+	}
+}
+
+// TestGone checks that operations on destroyed entities and their
+// descendants fail with gone error, same as they do in real drivers
+func TestGone(t *testing.T) {
+	fp, _ := newTestPlayground(t, testConfigs())
+	ctx := context.Background()
+	undo, err := fp.byID["p1"].DoReversible(ctx, model.NewOperation(model.OperationTypePause))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.byID["c1"].Do(ctx, model.NewOperation(model.OperationTypeDestroy)); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"c1", "p1"} {
+		err := fp.byID[id].Do(ctx, model.NewOperation(model.OperationTypePause))
+		if model.ClassifyError(err) != model.ErrorClassGone {
+			t.Errorf("Pause of destroyed %s: %v, want gone error", id, err)
+		}
+	}
+	if err := undo.Undo(ctx); model.ClassifyError(err) != model.ErrorClassGone {
+		t.Errorf("Undo on destroyed entity: %v, want gone error", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	configs := testConfigs()
+	configs[1].Status = "slow"
+	fp, _ := newTestPlayground(t, configs)
+	ctx := context.Background()
+	undo, err := fp.byID["c1"].DoReversible(ctx, model.NewOperation(model.OperationTypePause))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := undo.Undo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(t, fp, "c1"); got != model.StatusTypeSlow {
+		t.Errorf("Status after undo %s, want %s", got, model.StatusTypeSlow)
+	}
+	calls := fp.Calls()
+	if len(calls) != 2 || !calls[1].Undo {
+		t.Errorf("Calls %+v, want operation and its undo", calls)
+	}
+	undo, err = fp.byID["c1"].DoReversible(ctx, model.NewOperation(model.OperationTypeDestroy))
+	if err != nil || undo != nil {
+		t.Errorf("Destroy: undo %v, error %v, want no undo", undo, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want model.ErrorClass
+	}{
+		{msg: "transient: busy", want: model.ErrorClassTransient},
+		{msg: "gone: no such container", want: model.ErrorClassGone},
+		{msg: "denied", want: model.ErrorClassPermanent},
+	}
+	for _, tt := range tests {
+		configs := testConfigs()
+		configs[1].Errors = map[string]string{"pause": tt.msg, "status": tt.msg}
+		fp, _ := newTestPlayground(t, configs)
+		err := fp.byID["c1"].Do(context.Background(), model.NewOperation(model.OperationTypePause))
+		if model.ClassifyError(err) != tt.want || !strings.HasSuffix(tt.msg, err.Error()) {
+			t.Errorf("%q: pause error %v of class %v, want %v", tt.msg, err, model.ClassifyError(err), tt.want)
+		}
+		if _, err := fp.byID["c1"].Status(context.Background()); model.ClassifyError(err) != tt.want {
+			t.Errorf("%q: status error %v, want class %v", tt.msg, err, tt.want)
+		}
+		if err := fp.SetError("c1", model.OperationTypePause, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := fp.byID["c1"].Do(context.Background(), model.NewOperation(model.OperationTypePause)); err != nil {
+			t.Errorf("%q: pause after error is cleared: %v", tt.msg, err)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name         string
+		recoverAfter string
+		op           model.Operation
+		// after is virtual time passed after the operation
+		after time.Duration
+		want  model.StatusType
+	}{
+		{name: "not yet", recoverAfter: "5m", op: model.NewOperation(model.OperationTypePause), after: 4 * time.Minute, want: model.StatusTypePaused},
+		{name: "recovered", recoverAfter: "5m", op: model.NewOperation(model.OperationTypePause), after: 5 * time.Minute, want: model.StatusTypeWorking},
+		{name: "never", op: model.NewOperation(model.OperationTypePause), after: time.Hour, want: model.StatusTypePaused},
+		{
+			name:         "duration param",
+			recoverAfter: "5m",
+			op:           model.Operation{Type: model.OperationTypePause, Params: map[string]string{"duration": "1m"}},
+			after:        time.Minute,
+			want:         model.StatusTypeWorking,
+		},
+	}
+	for _, tt := range tests {
+		configs := testConfigs()
+		configs[1].RecoverAfter = tt.recoverAfter
+		fp, clock := newTestPlayground(t, configs)
+		if err := fp.byID["c1"].Do(context.Background(), tt.op); err != nil {
+			t.Fatal(err)
+		}
+		clock.Add(tt.after)
+		if got := status(t, fp, "c1"); got != tt.want {
+			t.Errorf("%s: status %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLatency(t *testing.T) {
+	configs := testConfigs()
+	configs[1].Latency = "2s"
+	fp, clock := newTestPlayground(t, configs)
+	fp.SetLatency(time.Second)
+	start := clock.Now()
+	if _, err := fp.Entities(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.byID["c1"].Do(context.Background(), model.NewOperation(model.OperationTypePause)); err != nil {
+		t.Fatal(err)
+	}
+	if d := clock.Now().Sub(start); d != 4*time.Second {
+		t.Errorf("Listing and operation took %s, want 4s", d)
+	}
+	clock.mu.Lock()
+	clock.stopped = true
+	clock.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fp.byID["c2"].Do(ctx, model.NewOperation(model.OperationTypePause)); err == nil {
+		t.Errorf("Operation done after ctx is done")
+	}
+	if got := status(t, fp, "c2"); got != model.StatusTypeWorking {
+		t.Errorf("Status after cancelled operation %s, want %s", got, model.StatusTypeWorking)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	fp, _ := newTestPlayground(t, testConfigs())
+	types := make(map[model.OperationType]string)
+	for _, spec := range fp.Capabilities() {
+		names := make([]string, 0, len(spec.Entities))
+		for _, et := range spec.Entities {
+			names = append(names, et.String())
+		}
+		types[spec.Operation] = strings.Join(names, ",")
+	}
+	tests := []struct {
+		op   model.OperationType
+		want string
+	}{
+		{op: model.OperationTypePause, want: "container,process,vm"},
+		// web-1 supports stop though db-1 does not
+		{op: model.OperationTypeStop, want: "container,process,vm"},
+		{op: model.OperationTypeDestroy, want: "container,process,vm"},
+	}
+	for _, tt := range tests {
+		if types[tt.op] != tt.want {
+			t.Errorf("%s is supported by %q, want %q", tt.op, types[tt.op], tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package k8s
+
+import (
+	"github.com/livepeer/swarm-chaos/internal/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// classifyError marks API errors that are worth retrying
+// and ones caused by objects that are gone
+func classifyError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err), apierrors.IsGone(err):
+		return model.GoneError(err)
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err), apierrors.IsUnexpectedServerError(err):
+		return model.TransientError(err)
+	}
+	return err
+}
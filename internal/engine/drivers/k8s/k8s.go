@@ -0,0 +1,158 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type (
+	// KubernetesPlayground represents nodes, pods, containers and
+	// workloads (deployments and statefulsets) of the cluster
+	KubernetesPlayground struct {
+		client kubernetes.Interface
+		// config is used to exec into containers, can be nil
+		config *rest.Config
+		// namespace pods and workloads are listed in, all if empty
+		namespace string
+		mu        sync.Mutex
+		// replicas of the workloads before they were scaled down
+		savedReplicas map[string]int32
+	}
+)
+
+// KillSignal is signal sent to the containers by the kill operation
+var KillSignal = "SIGKILL"
+
+// ScaleDownBy is number of replicas removed by the scale_down operation
+var ScaleDownBy int32 = 1
+
+// NewKubernetesPlayground creates a new kubernetes driver working through
+// client. config is used to exec into containers and can be nil,
+// in which case operations that need exec are not supported.
+func NewKubernetesPlayground(client kubernetes.Interface, config *rest.Config, namespace string) *KubernetesPlayground {
+	return &KubernetesPlayground{
+		client:        client,
+		config:        config,
+		namespace:     namespace,
+		savedReplicas: make(map[string]int32),
+	}
+}
+
+// NewKubernetesPlaygroundFromKubeconfig creates a new kubernetes driver
+// using kubeconfig file, or in-cluster config if kubeconfig is empty
+func NewKubernetesPlaygroundFromKubeconfig(kubeconfig, namespace string) (*KubernetesPlayground, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig == "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewKubernetesPlayground(client, config, namespace), nil
+}
+
+// Capabilities returns operations the driver can do and their parameters
+func (kp *KubernetesPlayground) Capabilities() []model.OperationSpec {
+	node := []model.EntityType{model.EntityTypeVM}
+	container := []model.EntityType{model.EntityTypeContainer}
+	workload := []model.EntityType{model.EntityTypeWorkload}
+	both := []model.EntityType{model.EntityTypeTask, model.EntityTypeContainer}
+	resumable := []model.EntityType{model.EntityTypeVM, model.EntityTypeWorkload}
+	stoppable := []model.EntityType{model.EntityTypeTask, model.EntityTypeContainer, model.EntityTypeWorkload}
+	return []model.OperationSpec{
+		{Operation: model.OperationTypePause, Entities: node},
+		{Operation: model.OperationTypeDrain, Entities: node},
+		{Operation: model.OperationTypeResume, Entities: resumable},
+		{Operation: model.OperationTypeDestroy, Entities: both},
+		{Operation: model.OperationTypeStop, Entities: stoppable},
+		{Operation: model.OperationTypeKill, Entities: container, Params: []model.ParamSpec{model.ParamSignal}},
+		{Operation: model.OperationTypeScaleDown, Entities: workload, Params: []model.ParamSpec{model.ParamBy}},
+		{Operation: model.OperationTypeStart, Entities: workload},
+	}
+}
+
+// Entities returns a list of all the entities:
+// nodes, workloads, pods and containers
+func (kp *KubernetesPlayground) Entities() ([]model.Entity, error) {
+	ctx := context.Background()
+	res := make([]model.Entity, 0)
+	pods, err := kp.client.CoreV1().Pods(kp.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*k8sNode)
+	// nodes are cluster-wide and may be not visible
+	// to the service account scoped to a namespace
+	nodeList, err := kp.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		glog.Infof("Error getting nodes list: %v", err)
+	} else {
+		for _, node := range nodeList.Items {
+			kn := &k8sNode{
+				node: node,
+				kp:   kp,
+			}
+			nodes[node.Name] = kn
+			res = append(res, kn)
+		}
+	}
+	workloads, err := kp.listWorkloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, kw := range workloads {
+		res = append(res, kw)
+	}
+	for _, pod := range pods.Items {
+		kpod := &k8sPod{
+			pod: pod,
+			kp:  kp,
+		}
+		if kn, has := nodes[pod.Spec.NodeName]; has {
+			kpod.parent = kn
+			kn.childs = append(kn.childs, kpod)
+		}
+		res = append(res, kpod)
+		for _, c := range pod.Spec.Containers {
+			kc := &k8sContainer{
+				pod:  kpod,
+				name: c.Name,
+			}
+			kpod.childs = append(kpod.childs, kc)
+			res = append(res, kc)
+		}
+	}
+	return res, nil
+}
+
+// isDaemonSetPod returns true if pod is managed by DaemonSet
+// and so will not be moved to another node
+func isDaemonSetPod(pod *corev1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// isMirrorPod returns true if pod is static pod mirrored by the kubelet
+func isMirrorPod(pod *corev1.Pod) bool {
+	_, has := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return has
+}
@@ -0,0 +1,307 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// newTestPlayground returns playground of fake cluster with node n1
+// running pod web-1 of two containers, deployment web of 3 replicas
+// and statefulset db of 2 replicas
+func newTestPlayground() (*KubernetesPlayground, *fake.Clientset) {
+	objects := []runtime.Object{
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "n1", UID: "node-1", Labels: map[string]string{"zone": "a"}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", UID: "pod-1", Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{
+				NodeName:   "n1",
+				Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "deploy-1", Labels: map[string]string{"app": "web"}},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", UID: "sts-1"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(2)},
+		},
+	}
+	client := fake.NewSimpleClientset(objects...)
+	return NewKubernetesPlayground(client, nil, ""), client
+}
+
+// entity returns entity with the name
+func entity(t *testing.T, kp *KubernetesPlayground, name string) model.Entity {
+	t.Helper()
+	entities, err := kp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if e.Name() == name {
+			return e
+		}
+	}
+	t.Fatalf("No entity %s", name)
+	return nil
+}
+
+func TestEntities(t *testing.T) {
+	kp, _ := newTestPlayground()
+	tests := []struct {
+		name   string
+		etype  model.EntityType
+		parent string
+		childs int
+	}{
+		{name: "n1", etype: model.EntityTypeVM, childs: 1},
+		{name: "default/web-1", etype: model.EntityTypeTask, parent: "n1", childs: 2},
+		{name: "default/web-1/app", etype: model.EntityTypeContainer, parent: "default/web-1"},
+		{name: "default/web-1/sidecar", etype: model.EntityTypeContainer, parent: "default/web-1"},
+		{name: "deployment/default/web", etype: model.EntityTypeWorkload},
+		{name: "statefulset/default/db", etype: model.EntityTypeWorkload},
+	}
+	entities, err := kp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != len(tests) {
+		t.Errorf("Got %d entities, want %d", len(entities), len(tests))
+	}
+	for _, tt := range tests {
+		e := entity(t, kp, tt.name)
+		if e.Type() != tt.etype {
+			t.Errorf("Type of %s = %s, want %s", tt.name, e.Type(), tt.etype)
+		}
+		parent := ""
+		if e.Parent() != nil {
+			parent = e.Parent().Name()
+		}
+		if parent != tt.parent {
+			t.Errorf("Parent of %s = %q, want %q", tt.name, parent, tt.parent)
+		}
+		if len(e.Childs()) != tt.childs {
+			t.Errorf("%s has %d childs, want %d", tt.name, len(e.Childs()), tt.childs)
+		}
+	}
+}
+
+// TestDeletePod checks that operations destroying pod or its
+// containers delete the pod
+func TestDeletePod(t *testing.T) {
+	tests := []struct {
+		entity string
+		op     model.Operation
+	}{
+		{entity: "default/web-1", op: model.NewOperation(model.OperationTypeDestroy)},
+		{entity: "default/web-1", op: model.NewOperation(model.OperationTypeStop)},
+		{entity: "default/web-1/app", op: model.NewOperation(model.OperationTypeDestroy)},
+		{entity: "default/web-1/app", op: model.NewOperation(model.OperationTypeStop)},
+		{entity: "default/web-1/app", op: model.NewOperation(model.OperationTypeKill)},
+		{entity: "default/web-1/app", op: model.Operation{Type: model.OperationTypeKill, Params: map[string]string{"signal": "9"}}},
+	}
+	for _, tt := range tests {
+		kp, client := newTestPlayground()
+		ctx := context.Background()
+		e := entity(t, kp, tt.entity)
+		if err := e.Do(ctx, tt.op); err != nil {
+			t.Errorf("%s of %s: %v", tt.op, tt.entity, err)
+			continue
+		}
+		_, err := client.CoreV1().Pods("default").Get(ctx, "web-1", metav1.GetOptions{})
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("%s of %s didn't delete the pod: %v", tt.op, tt.entity, err)
+		}
+		if _, err := e.Status(ctx); model.ClassifyError(err) != model.ErrorClassGone {
+			t.Errorf("Status of %s after %s: %v, want gone error", tt.entity, tt.op, err)
+		}
+	}
+}
+
+func TestKillSignal(t *testing.T) {
+	kp, _ := newTestPlayground()
+	e := entity(t, kp, "default/web-1/app")
+	tests := []struct {
+		signal string
+		// other signals need exec, which isn't possible without cluster config
+		wantErr bool
+	}{
+		{signal: "KILL; rm -rf /", wantErr: true},
+		{signal: "SIGTERM", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := e.Do(context.Background(), model.Operation{Type: model.OperationTypeKill, Params: map[string]string{"signal": tt.signal}})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Kill by %q error = %v, want error %v", tt.signal, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNodeOperations(t *testing.T) {
+	tests := []struct {
+		op     model.OperationType
+		status model.StatusType
+	}{
+		{op: model.OperationTypePause, status: model.StatusTypePaused},
+		{op: model.OperationTypeDrain, status: model.StatusTypePaused},
+	}
+	for _, tt := range tests {
+		kp, client := newTestPlayground()
+		ctx := context.Background()
+		kn := entity(t, kp, "n1").(*k8sNode)
+		undo, err := kn.DoReversible(ctx, model.NewOperation(tt.op))
+		if err != nil {
+			t.Errorf("%s: %v", tt.op, err)
+			continue
+		}
+		node, _ := client.CoreV1().Nodes().Get(ctx, "n1", metav1.GetOptions{})
+		if !node.Spec.Unschedulable {
+			t.Errorf("Node is schedulable after %s", tt.op)
+		}
+		if status, _ := kn.Status(ctx); status != tt.status {
+			t.Errorf("Status after %s = %s, want %s", tt.op, status, tt.status)
+		}
+		if err := undo.Undo(ctx); err != nil {
+			t.Errorf("Undo of %s: %v", tt.op, err)
+		}
+		if status, _ := kn.Status(ctx); status != model.StatusTypeWorking {
+			t.Errorf("Status after undo of %s = %s, want %s", tt.op, status, model.StatusTypeWorking)
+		}
+	}
+}
+
+func TestWorkloadScale(t *testing.T) {
+	tests := []struct {
+		workload string
+		op       model.Operation
+		replicas int32
+		status   model.StatusType
+		restored int32
+	}{
+		{
+			workload: "deployment/default/web",
+			op:       model.NewOperation(model.OperationTypeScaleDown),
+			replicas: 2,
+			status:   model.StatusTypeSlow,
+			restored: 3,
+		},
+		{
+			workload: "deployment/default/web",
+			op:       model.Operation{Type: model.OperationTypeScaleDown, Params: map[string]string{"by": "5"}},
+			replicas: 0,
+			status:   model.StatusTypeStopped,
+			restored: 3,
+		},
+		{
+			workload: "statefulset/default/db",
+			op:       model.NewOperation(model.OperationTypeStop),
+			replicas: 0,
+			status:   model.StatusTypeStopped,
+			restored: 2,
+		},
+	}
+	for _, tt := range tests {
+		kp, _ := newTestPlayground()
+		ctx := context.Background()
+		kw := entity(t, kp, tt.workload).(*k8sWorkload)
+		undo, err := kw.DoReversible(ctx, tt.op)
+		if err != nil {
+			t.Errorf("%s of %s: %v", tt.op, tt.workload, err)
+			continue
+		}
+		if replicas, _ := kw.getReplicas(ctx); replicas != tt.replicas {
+			t.Errorf("%s of %s: %d replicas, want %d", tt.op, tt.workload, replicas, tt.replicas)
+		}
+		if status, _ := kw.Status(ctx); status != tt.status {
+			t.Errorf("Status after %s of %s = %s, want %s", tt.op, tt.workload, status, tt.status)
+		}
+		if err := undo.Undo(ctx); err != nil {
+			t.Errorf("Undo of %s: %v", tt.op, err)
+		}
+		if replicas, _ := kw.getReplicas(ctx); replicas != tt.restored {
+			t.Errorf("Undo of %s of %s: %d replicas, want %d", tt.op, tt.workload, replicas, tt.restored)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	kp, _ := newTestPlayground()
+	specs := kp.Capabilities()
+	tests := []struct {
+		op      model.Operation
+		wantErr bool
+	}{
+		{op: model.Operation{Type: model.OperationTypeKill, Params: map[string]string{"signal": "TERM"}}},
+		{op: model.Operation{Type: model.OperationTypeKill, Params: map[string]string{"signal": "TERM 1; id"}}, wantErr: true},
+		{op: model.Operation{Type: model.OperationTypeScaleDown, Params: map[string]string{"by": "2"}}},
+		{op: model.Operation{Type: model.OperationTypeScaleDown, Params: map[string]string{"by": "two"}}, wantErr: true},
+		{op: model.Operation{Type: model.OperationTypeScaleDown, Params: map[string]string{"by": "0"}}, wantErr: true},
+		{op: model.NewOperation(model.OperationTypeSlowdown), wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := model.ValidateOperation(tt.op, specs); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateOperation(%s) error = %v, want error %v", tt.op, err, tt.wantErr)
+		}
+	}
+}
+
+// TestExecCancelled checks that exec into container gives up when
+// ctx is done, though API server never answers it
+func TestExecCancelled(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+	config := &rest.Config{Host: ts.URL}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp := NewKubernetesPlayground(client, config, "")
+	kpod := &k8sPod{
+		pod: corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", UID: "pod-1"}},
+		kp:  kp,
+	}
+	kc := &k8sContainer{pod: kpod, name: "app"}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- kc.Do(ctx, model.Operation{Type: model.OperationTypeKill, Params: map[string]string{"signal": "SIGTERM"}})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Kill error %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Kill didn't give up after ctx was done")
+	}
+}
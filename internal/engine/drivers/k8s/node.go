@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+type (
+	// k8sNode is a cluster node. Cordoning or draining it
+	// simulates losing a whole machine.
+	k8sNode struct {
+		node   corev1.Node
+		kp     *KubernetesPlayground
+		childs []model.Entity
+	}
+)
+
+func (kn *k8sNode) ID() string {
+	return string(kn.node.UID)
+}
+
+func (kn *k8sNode) Name() string {
+	return kn.node.Name
+}
+
+func (kn *k8sNode) Labels() map[string]string {
+	return kn.node.Labels
+}
+
+func (kn *k8sNode) Parent() model.Entity {
+	return nil
+}
+
+// Childs returns pods running on the node
+func (kn *k8sNode) Childs() []model.Entity {
+	return kn.childs
+}
+
+func (kn *k8sNode) Type() model.EntityType {
+	return model.EntityTypeVM
+}
+
+func (kn *k8sNode) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(kn.do(ctx, operation))
+}
+
+func (kn *k8sNode) do(ctx context.Context, operation model.Operation) error {
+	switch operation.Type {
+	case model.OperationTypePause:
+		return kn.setUnschedulable(ctx, true)
+	case model.OperationTypeDrain:
+		if err := kn.setUnschedulable(ctx, true); err != nil {
+			return err
+		}
+		return kn.evictPods(ctx)
+	case model.OperationTypeResume:
+		return kn.setUnschedulable(ctx, false)
+	}
+	return model.ErrOperationNotSupported
+}
+
+func (kn *k8sNode) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := kn.status(ctx)
+	return status, classifyError(err)
+}
+
+func (kn *k8sNode) status(ctx context.Context) (model.StatusType, error) {
+	node, err := kn.kp.client.CoreV1().Nodes().Get(ctx, kn.node.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady && cond.Status != corev1.ConditionTrue {
+			return model.StatusTypeDestroyed, nil
+		}
+	}
+	if node.Spec.Unschedulable {
+		return model.StatusTypePaused, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+// setUnschedulable cordons or uncordons the node
+func (kn *k8sNode) setUnschedulable(ctx context.Context, unschedulable bool) error {
+	nodes := kn.kp.client.CoreV1().Nodes()
+	node, err := nodes.Get(ctx, kn.node.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if node.Spec.Unschedulable == unschedulable {
+		return nil
+	}
+	glog.Infof("Setting node %s unschedulable to %v", kn.node.Name, unschedulable)
+	node.Spec.Unschedulable = unschedulable
+	_, err = nodes.Update(ctx, node, metav1.UpdateOptions{})
+	return err
+}
+
+// evictPods evicts all the pods from the node, except ones
+// managed by DaemonSets and mirror pods, same as kubectl drain
+func (kn *k8sNode) evictPods(ctx context.Context) error {
+	pods, err := kn.kp.client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", kn.node.Name).String(),
+	})
+	if err != nil {
+		return err
+	}
+	var failed int
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if isDaemonSetPod(pod) || isMirrorPod(pod) {
+			continue
+		}
+		glog.Infof("Evicting pod %s/%s from node %s", pod.Namespace, pod.Name, kn.node.Name)
+		err := kn.kp.client.CoreV1().Pods(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		})
+		if err != nil {
+			glog.Infof("Error evicting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to evict %d pods from node %s", failed, kn.node.Name)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+type (
+	k8sPod struct {
+		pod    corev1.Pod
+		kp     *KubernetesPlayground
+		parent model.Entity
+		childs []model.Entity
+	}
+
+	// k8sContainer is a container of the pod
+	k8sContainer struct {
+		pod  *k8sPod
+		name string
+	}
+)
+
+func (kpod *k8sPod) ID() string {
+	return string(kpod.pod.UID)
+}
+
+func (kpod *k8sPod) Name() string {
+	return kpod.pod.Namespace + "/" + kpod.pod.Name
+}
+
+func (kpod *k8sPod) Labels() map[string]string {
+	return kpod.pod.Labels
+}
+
+func (kpod *k8sPod) Parent() model.Entity {
+	return kpod.parent
+}
+
+// Childs returns containers of the pod
+func (kpod *k8sPod) Childs() []model.Entity {
+	return kpod.childs
+}
+
+// Type returns task type, as pod plays the same role
+// swarm task does: it is a scheduled unit between node
+// and containers
+func (kpod *k8sPod) Type() model.EntityType {
+	return model.EntityTypeTask
+}
+
+func (kpod *k8sPod) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(kpod.do(ctx, operation))
+}
+
+func (kpod *k8sPod) do(ctx context.Context, operation model.Operation) error {
+	pods := kpod.kp.client.CoreV1().Pods(kpod.pod.Namespace)
+	switch operation.Type {
+	case model.OperationTypeDestroy:
+		var grace int64
+		glog.Infof("Deleting pod %s", kpod.Name())
+		return pods.Delete(ctx, kpod.pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &grace})
+	case model.OperationTypeStop:
+		glog.Infof("Gracefully deleting pod %s", kpod.Name())
+		return pods.Delete(ctx, kpod.pod.Name, metav1.DeleteOptions{})
+	}
+	return model.ErrOperationNotSupported
+}
+
+func (kpod *k8sPod) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := kpod.status(ctx)
+	return status, classifyError(err)
+}
+
+func (kpod *k8sPod) status(ctx context.Context) (model.StatusType, error) {
+	pod, err := kpod.kp.client.CoreV1().Pods(kpod.pod.Namespace).Get(ctx, kpod.pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if pod.DeletionTimestamp != nil {
+		return model.StatusTypeDestroyed, nil
+	}
+	switch pod.Status.Phase {
+	case corev1.PodFailed, corev1.PodSucceeded:
+		return model.StatusTypeDestroyed, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+func (kc *k8sContainer) ID() string {
+	return kc.pod.ID() + "/" + kc.name
+}
+
+func (kc *k8sContainer) Name() string {
+	return kc.pod.Name() + "/" + kc.name
+}
+
+// Labels returns labels of the container's pod
+func (kc *k8sContainer) Labels() map[string]string {
+	return kc.pod.Labels()
+}
+
+func (kc *k8sContainer) Parent() model.Entity {
+	return kc.pod
+}
+
+func (kc *k8sContainer) Childs() []model.Entity {
+	return nil
+}
+
+func (kc *k8sContainer) Type() model.EntityType {
+	return model.EntityTypeContainer
+}
+
+func (kc *k8sContainer) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(kc.do(ctx, operation))
+}
+
+// do destroys and stops container by deleting its pod, as kubelet
+// can't be asked to kill single container. Kill signals main process
+// of the container through exec. It is PID 1 in the container, so
+// the kernel only delivers signals it has handlers for, and SIGKILL
+// is never delivered, so kill by SIGKILL deletes the pod too.
+func (kc *k8sContainer) do(ctx context.Context, operation model.Operation) error {
+	switch operation.Type {
+	case model.OperationTypeDestroy, model.OperationTypeStop:
+		return kc.pod.do(ctx, operation)
+	case model.OperationTypeKill:
+		signal, err := model.ParseSignal(operation.Param(model.ParamSignal.Name, KillSignal))
+		if err != nil {
+			return err
+		}
+		if signal == "SIGKILL" {
+			return kc.pod.do(ctx, model.NewOperation(model.OperationTypeDestroy))
+		}
+		return kc.signal(ctx, signal)
+	}
+	return model.ErrOperationNotSupported
+}
+
+func (kc *k8sContainer) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := kc.status(ctx)
+	return status, classifyError(err)
+}
+
+func (kc *k8sContainer) status(ctx context.Context) (model.StatusType, error) {
+	pod, err := kc.pod.kp.client.CoreV1().Pods(kc.pod.pod.Namespace).Get(ctx, kc.pod.pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != kc.name {
+			continue
+		}
+		switch {
+		case cs.State.Terminated != nil:
+			return model.StatusTypeDestroyed, nil
+		case cs.State.Waiting != nil:
+			return model.StatusTypeStopped, nil
+		}
+		return model.StatusTypeWorking, nil
+	}
+	return model.StatusTypeDestroyed, nil
+}
+
+func (kc *k8sContainer) signal(ctx context.Context, signal string) error {
+	signal, err := model.ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Sending %s to container %s", signal, kc.Name())
+	// use shell's builtin kill, images may not have kill binary,
+	// signal is passed as argument, not in the script
+	_, err = kc.exec(ctx, "sh", "-c", `kill -s "$1" 1`, "sh", strings.TrimPrefix(signal, "SIG"))
+	return err
+}
+
+// exec runs command inside the container and returns its output
+func (kc *k8sContainer) exec(ctx context.Context, cmd ...string) (string, error) {
+	kp := kc.pod.kp
+	if kp.config == nil {
+		return "", fmt.Errorf("Can't exec into container %s: no cluster config", kc.Name())
+	}
+	req := kp.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(kc.pod.pod.Name).
+		Namespace(kc.pod.pod.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: kc.name,
+			Command:   cmd,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(kp.config, "POST", req.URL())
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	// Stream doesn't take ctx, so it is left running when ctx is done,
+	// its buffers aren't touched after that
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(remotecommand.StreamOptions{
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+	}()
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("Command %v in container %s: %w", cmd, kc.Name(), ctx.Err())
+	case err = <-done:
+	}
+	if err != nil {
+		return "", fmt.Errorf("Command %v in container %s failed: %v: %s", cmd, kc.Name(), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,41 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// newUndo returns undo calling f, with errors classified
+func newUndo(what string, f func(ctx context.Context) error) model.Undo {
+	return model.NewUndo(what, func(ctx context.Context) error {
+		return classifyError(f(ctx))
+	})
+}
+
+// DoReversible does operation, returning handle that reverts it.
+// Evicted pods are not moved back, only the node is uncordoned.
+func (kn *k8sNode) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := kn.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	switch operation.Type {
+	case model.OperationTypePause, model.OperationTypeDrain:
+		return newUndo("uncordon", func(ctx context.Context) error {
+			return kn.setUnschedulable(ctx, false)
+		}), nil
+	}
+	return nil, nil
+}
+
+// DoReversible does operation, returning handle that reverts it
+func (kw *k8sWorkload) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := kw.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	switch operation.Type {
+	case model.OperationTypeScaleDown, model.OperationTypeStop:
+		return newUndo("restore replicas", kw.restoreScale), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,210 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type (
+	// k8sWorkload is a deployment or statefulset
+	k8sWorkload struct {
+		kind      string
+		namespace string
+		name      string
+		uid       string
+		labels    map[string]string
+		kp        *KubernetesPlayground
+	}
+)
+
+const (
+	kindDeployment  = "deployment"
+	kindStatefulSet = "statefulset"
+)
+
+func (kp *KubernetesPlayground) listWorkloads(ctx context.Context) ([]*k8sWorkload, error) {
+	res := make([]*k8sWorkload, 0)
+	deployments, err := kp.client.AppsV1().Deployments(kp.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		res = append(res, &k8sWorkload{
+			kind:      kindDeployment,
+			namespace: d.Namespace,
+			name:      d.Name,
+			uid:       string(d.UID),
+			labels:    d.Labels,
+			kp:        kp,
+		})
+	}
+	statefulSets, err := kp.client.AppsV1().StatefulSets(kp.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets.Items {
+		res = append(res, &k8sWorkload{
+			kind:      kindStatefulSet,
+			namespace: s.Namespace,
+			name:      s.Name,
+			uid:       string(s.UID),
+			labels:    s.Labels,
+			kp:        kp,
+		})
+	}
+	return res, nil
+}
+
+func (kw *k8sWorkload) ID() string {
+	return kw.uid
+}
+
+func (kw *k8sWorkload) Name() string {
+	return kw.kind + "/" + kw.namespace + "/" + kw.name
+}
+
+func (kw *k8sWorkload) Labels() map[string]string {
+	return kw.labels
+}
+
+func (kw *k8sWorkload) Parent() model.Entity {
+	return nil
+}
+
+func (kw *k8sWorkload) Childs() []model.Entity {
+	return nil
+}
+
+func (kw *k8sWorkload) Type() model.EntityType {
+	return model.EntityTypeWorkload
+}
+
+func (kw *k8sWorkload) Do(ctx context.Context, operation model.Operation) error {
+	return classifyError(kw.do(ctx, operation))
+}
+
+func (kw *k8sWorkload) do(ctx context.Context, operation model.Operation) error {
+	switch operation.Type {
+	case model.OperationTypeScaleDown:
+		return kw.scaleDown(ctx, int32(operation.Int(model.ParamBy.Name, int(ScaleDownBy))))
+	case model.OperationTypeStop:
+		return kw.scaleDown(ctx, -1)
+	case model.OperationTypeResume, model.OperationTypeStart:
+		return kw.restoreScale(ctx)
+	}
+	return model.ErrOperationNotSupported
+}
+
+func (kw *k8sWorkload) Status(ctx context.Context) (model.StatusType, error) {
+	status, err := kw.status(ctx)
+	return status, classifyError(err)
+}
+
+func (kw *k8sWorkload) status(ctx context.Context) (model.StatusType, error) {
+	replicas, err := kw.getReplicas(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if replicas == 0 {
+		return model.StatusTypeStopped, nil
+	}
+	kw.kp.mu.Lock()
+	_, scaledDown := kw.kp.savedReplicas[kw.Name()]
+	kw.kp.mu.Unlock()
+	if scaledDown {
+		return model.StatusTypeSlow, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+// scaleDown removes by replicas, all the replicas if by is negative,
+// remembering original number of replicas
+func (kw *k8sWorkload) scaleDown(ctx context.Context, by int32) error {
+	current, err := kw.getReplicas(ctx)
+	if err != nil {
+		return err
+	}
+	replicas := current - by
+	if by < 0 || replicas < 0 {
+		replicas = 0
+	}
+	if replicas == current {
+		return nil
+	}
+	kw.kp.mu.Lock()
+	if _, has := kw.kp.savedReplicas[kw.Name()]; !has {
+		kw.kp.savedReplicas[kw.Name()] = current
+	}
+	kw.kp.mu.Unlock()
+	glog.Infof("Scaling %s from %d to %d replicas", kw.Name(), current, replicas)
+	return kw.setReplicas(ctx, replicas)
+}
+
+// restoreScale sets number of replicas back to the one before scale down
+func (kw *k8sWorkload) restoreScale(ctx context.Context) error {
+	kw.kp.mu.Lock()
+	replicas, has := kw.kp.savedReplicas[kw.Name()]
+	delete(kw.kp.savedReplicas, kw.Name())
+	kw.kp.mu.Unlock()
+	if !has {
+		return nil
+	}
+	glog.Infof("Restoring %s to %d replicas", kw.Name(), replicas)
+	return kw.setReplicas(ctx, replicas)
+}
+
+// getReplicas returns desired number of replicas.
+// Workload objects are used instead of scale subresource,
+// so the driver works with fake clientset too.
+func (kw *k8sWorkload) getReplicas(ctx context.Context) (int32, error) {
+	apps := kw.kp.client.AppsV1()
+	var replicas *int32
+	switch kw.kind {
+	case kindDeployment:
+		d, err := apps.Deployments(kw.namespace).Get(ctx, kw.name, metav1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+		replicas = d.Spec.Replicas
+	case kindStatefulSet:
+		s, err := apps.StatefulSets(kw.namespace).Get(ctx, kw.name, metav1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+		replicas = s.Spec.Replicas
+	default:
+		return 0, fmt.Errorf("Unknown workload kind %s", kw.kind)
+	}
+	if replicas == nil {
+		// defaulted by the API server
+		return 1, nil
+	}
+	return *replicas, nil
+}
+
+func (kw *k8sWorkload) setReplicas(ctx context.Context, replicas int32) error {
+	apps := kw.kp.client.AppsV1()
+	switch kw.kind {
+	case kindDeployment:
+		d, err := apps.Deployments(kw.namespace).Get(ctx, kw.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		d.Spec.Replicas = &replicas
+		_, err = apps.Deployments(kw.namespace).Update(ctx, d, metav1.UpdateOptions{})
+		return err
+	case kindStatefulSet:
+		s, err := apps.StatefulSets(kw.namespace).Get(ctx, kw.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		s.Spec.Replicas = &replicas
+		_, err = apps.StatefulSets(kw.namespace).Update(ctx, s, metav1.UpdateOptions{})
+		return err
+	}
+	return fmt.Errorf("Unknown workload kind %s", kw.kind)
+}
@@ -0,0 +1,403 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// ProcessConfig describes processes managed by the driver.
+	// Process is either spawned by the driver from Command,
+	// or discovered by PidFile or by Match regexp matched
+	// against command lines of running processes.
+	ProcessConfig struct {
+		Name    string            `json:"name"`
+		Command []string          `json:"command,omitempty"`
+		Dir     string            `json:"dir,omitempty"`
+		Env     []string          `json:"env,omitempty"`
+		Match   string            `json:"match,omitempty"`
+		PidFile string            `json:"pid_file,omitempty"`
+		Labels  map[string]string `json:"labels,omitempty"`
+	}
+
+	// LocalPlayground manages OS processes of the local machine
+	LocalPlayground struct {
+		configs  []ProcessConfig
+		matchers []*regexp.Regexp
+		mu       sync.Mutex
+		// processes spawned from the configs, by config name
+		spawned map[string]*spawnedProcess
+	}
+
+	spawnedProcess struct {
+		cmd  *exec.Cmd
+		done chan struct{}
+	}
+
+	localProcess struct {
+		lp     *LocalPlayground
+		config *ProcessConfig
+		// pid is zero if process is not running
+		pid  int
+		args []string
+	}
+)
+
+// KillSignal is signal sent to the processes by the kill operation
+var KillSignal = "SIGKILL"
+
+// StopTimeout is how long process has to exit after SIGTERM on restart
+var StopTimeout = 10 * time.Second
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGABRT": syscall.SIGABRT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGPIPE": syscall.SIGPIPE,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGCONT": syscall.SIGCONT,
+	"SIGSTOP": syscall.SIGSTOP,
+	"SIGTSTP": syscall.SIGTSTP,
+}
+
+// parseSignal returns signal by its name (SIGKILL or KILL) or number
+func parseSignal(name string) (syscall.Signal, error) {
+	name, err := model.ParseSignal(name)
+	if err != nil {
+		return 0, err
+	}
+	return signals[name], nil
+}
+
+// LoadConfig reads processes configs from JSON file
+func LoadConfig(path string) ([]ProcessConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]ProcessConfig, 0)
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return configs, nil
+}
+
+// NewLocalPlayground creates a new local processes driver
+// and spawns processes that have command specified
+func NewLocalPlayground(configs []ProcessConfig) (*LocalPlayground, error) {
+	lp := &LocalPlayground{
+		configs:  configs,
+		matchers: make([]*regexp.Regexp, len(configs)),
+		spawned:  make(map[string]*spawnedProcess),
+	}
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("Process config #%d has no name", i)
+		}
+		if len(config.Command) == 0 && config.PidFile == "" && config.Match == "" {
+			return nil, fmt.Errorf("Process %s should have command, pid_file or match", config.Name)
+		}
+		if config.Match != "" {
+			re, err := regexp.Compile(config.Match)
+			if err != nil {
+				return nil, fmt.Errorf("Bad match of process %s: %v", config.Name, err)
+			}
+			lp.matchers[i] = re
+		}
+	}
+	for i := range lp.configs {
+		if len(lp.configs[i].Command) > 0 {
+			if err := lp.spawn(&lp.configs[i], lp.configs[i].Command, lp.configs[i].Dir, lp.configs[i].Env); err != nil {
+				lp.Close()
+				return nil, err
+			}
+		}
+	}
+	return lp, nil
+}
+
+// Capabilities returns operations the driver can do and their parameters
+func (lp *LocalPlayground) Capabilities() []model.OperationSpec {
+	process := []model.EntityType{model.EntityTypeProcess}
+	return []model.OperationSpec{
+		{Operation: model.OperationTypeStart, Entities: process},
+		{Operation: model.OperationTypeRestart, Entities: process},
+		{Operation: model.OperationTypeDestroy, Entities: process},
+		{Operation: model.OperationTypeKill, Entities: process, Params: []model.ParamSpec{model.ParamSignal}},
+		{Operation: model.OperationTypeStop, Entities: process},
+		{Operation: model.OperationTypePause, Entities: process},
+		{Operation: model.OperationTypeResume, Entities: process},
+	}
+}
+
+// Entities returns a list of all the processes
+func (lp *LocalPlayground) Entities() ([]model.Entity, error) {
+	res := make([]model.Entity, 0, len(lp.configs))
+	var processes []psEntry
+	for i := range lp.configs {
+		config := &lp.configs[i]
+		switch {
+		case len(config.Command) > 0:
+			lp.mu.Lock()
+			sp := lp.spawned[config.Name]
+			lp.mu.Unlock()
+			lpr := &localProcess{lp: lp, config: config, args: config.Command}
+			if sp != nil && !sp.exited() {
+				lpr.pid = sp.cmd.Process.Pid
+			}
+			res = append(res, lpr)
+		case config.PidFile != "":
+			lpr := &localProcess{lp: lp, config: config}
+			if pid, err := readPidFile(config.PidFile); err == nil && processState(pid) != "" {
+				lpr.pid = pid
+				lpr.args = processArgs(pid, "")
+			} else if err != nil && !os.IsNotExist(err) {
+				glog.Infof("Process %s: %v", config.Name, err)
+			}
+			res = append(res, lpr)
+		default:
+			if processes == nil {
+				var err error
+				if processes, err = listProcesses(); err != nil {
+					return nil, err
+				}
+			}
+			for _, p := range processes {
+				if lp.matchers[i].MatchString(p.args) {
+					res = append(res, &localProcess{
+						lp:     lp,
+						config: config,
+						pid:    p.pid,
+						args:   processArgs(p.pid, p.args),
+					})
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// Close kills all the spawned processes
+func (lp *LocalPlayground) Close() {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	for name, sp := range lp.spawned {
+		if !sp.exited() {
+			glog.Infof("Killing spawned process %s", name)
+			sp.cmd.Process.Kill()
+		}
+	}
+}
+
+// spawn starts process, keeping track of it if it was spawned from config's command
+func (lp *LocalPlayground) spawn(config *ProcessConfig, args []string, dir string, env []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = env
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Error starting process %s: %v", config.Name, err)
+	}
+	glog.Infof("Started process %s with pid %d", config.Name, cmd.Process.Pid)
+	sp := &spawnedProcess{
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(sp.done)
+	}()
+	if len(config.Command) > 0 {
+		lp.mu.Lock()
+		lp.spawned[config.Name] = sp
+		lp.mu.Unlock()
+	}
+	return nil
+}
+
+func (sp *spawnedProcess) exited() bool {
+	select {
+	case <-sp.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ID is name of the config, so it stays the same when process
+// is restarted or not running. Processes found by match have
+// pid added, as there may be many of them.
+func (lpr *localProcess) ID() string {
+	if len(lpr.config.Command) == 0 && lpr.config.PidFile == "" {
+		return lpr.config.Name + "/" + strconv.Itoa(lpr.pid)
+	}
+	return lpr.config.Name
+}
+
+func (lpr *localProcess) Name() string {
+	return lpr.config.Name
+}
+
+func (lpr *localProcess) Labels() map[string]string {
+	return lpr.config.Labels
+}
+
+func (lpr *localProcess) Parent() model.Entity {
+	return nil
+}
+
+func (lpr *localProcess) Childs() []model.Entity {
+	return nil
+}
+
+func (lpr *localProcess) Type() model.EntityType {
+	return model.EntityTypeProcess
+}
+
+func (lpr *localProcess) Do(ctx context.Context, operation model.Operation) error {
+	switch operation.Type {
+	case model.OperationTypeStart:
+		if lpr.pid != 0 {
+			return nil
+		}
+		if len(lpr.config.Command) == 0 {
+			return fmt.Errorf("Process %s was not spawned by chaos, can't start it", lpr.config.Name)
+		}
+		return lpr.lp.spawn(lpr.config, lpr.config.Command, lpr.config.Dir, lpr.config.Env)
+	case model.OperationTypeRestart:
+		return lpr.restart(ctx)
+	}
+	if lpr.pid == 0 {
+		return fmt.Errorf("Process %s is not running", lpr.config.Name)
+	}
+	switch operation.Type {
+	case model.OperationTypeDestroy:
+		return lpr.signal("SIGKILL")
+	case model.OperationTypeKill:
+		return lpr.signal(operation.Param(model.ParamSignal.Name, KillSignal))
+	case model.OperationTypeStop:
+		return lpr.signal("SIGTERM")
+	case model.OperationTypePause:
+		return lpr.signal("SIGSTOP")
+	case model.OperationTypeResume:
+		return lpr.signal("SIGCONT")
+	}
+	return model.ErrOperationNotSupported
+}
+
+// DoReversible does operation, returning handle that reverts it
+func (lpr *localProcess) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := lpr.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	if operation.Type == model.OperationTypePause {
+		return model.NewUndo("continue", func(ctx context.Context) error {
+			return lpr.signal("SIGCONT")
+		}), nil
+	}
+	return nil, nil
+}
+
+func (lpr *localProcess) Status(ctx context.Context) (model.StatusType, error) {
+	if lpr.pid == 0 {
+		return model.StatusTypeDestroyed, nil
+	}
+	state := processState(lpr.pid)
+	if state == "" {
+		return model.StatusTypeDestroyed, nil
+	}
+	switch state[0] {
+	case 'T':
+		return model.StatusTypePaused, nil
+	case 'Z', 'X':
+		return model.StatusTypeDestroyed, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+func (lpr *localProcess) signal(name string) error {
+	sig, err := parseSignal(name)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Sending %s to process %s (%d)", name, lpr.config.Name, lpr.pid)
+	return syscall.Kill(lpr.pid, sig)
+}
+
+// restart terminates process and starts it again with the same
+// command line, directory and environment
+func (lpr *localProcess) restart(ctx context.Context) error {
+	args, dir, env := lpr.config.Command, lpr.config.Dir, lpr.config.Env
+	if len(args) == 0 {
+		if lpr.pid == 0 || len(lpr.args) == 0 {
+			return fmt.Errorf("Process %s is not running, don't know how to start it", lpr.config.Name)
+		}
+		args, dir, env = lpr.args, processDir(lpr.pid), processEnv(lpr.pid)
+	}
+	if lpr.pid != 0 {
+		if err := lpr.terminate(ctx); err != nil {
+			return err
+		}
+	}
+	return lpr.lp.spawn(lpr.config, args, dir, env)
+}
+
+// terminate sends SIGTERM to the process, and SIGKILL
+// if it is not exited after StopTimeout. Waiting is given up when ctx is done.
+func (lpr *localProcess) terminate(ctx context.Context) error {
+	// stopped process can't handle SIGTERM
+	syscall.Kill(lpr.pid, syscall.SIGCONT)
+	if err := lpr.signal("SIGTERM"); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(StopTimeout)
+	for time.Now().Before(deadline) {
+		if !lpr.running() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if err := lpr.signal("SIGKILL"); err != nil {
+		return err
+	}
+	for i := 0; i < 50 && lpr.running(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+func (lpr *localProcess) running() bool {
+	if len(lpr.config.Command) > 0 {
+		lpr.lp.mu.Lock()
+		sp := lpr.lp.spawned[lpr.config.Name]
+		lpr.lp.mu.Unlock()
+		if sp != nil && sp.cmd.Process.Pid == lpr.pid {
+			return !sp.exited()
+		}
+	}
+	state := processState(lpr.pid)
+	return state != "" && state[0] != 'Z' && state[0] != 'X'
+}
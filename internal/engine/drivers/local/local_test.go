@@ -0,0 +1,207 @@
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// sleepConfig is config of the process spawned by the driver
+var sleepConfig = ProcessConfig{Name: "sleeper", Command: []string{"sleep", "60"}, Labels: map[string]string{"app": "sleep"}}
+
+// newTestPlayground spawns sleep, returns the playground and function killing it
+func newTestPlayground(t *testing.T, configs ...ProcessConfig) (*LocalPlayground, func()) {
+	t.Helper()
+	lp, err := NewLocalPlayground(append([]ProcessConfig{sleepConfig}, configs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lp, lp.Close
+}
+
+// process returns entity of the config with the name
+func process(t *testing.T, lp *LocalPlayground, name string) *localProcess {
+	t.Helper()
+	entities, err := lp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if e.Name() == name {
+			return e.(*localProcess)
+		}
+	}
+	t.Fatalf("No process %s", name)
+	return nil
+}
+
+// waitStatus waits for process of the config to get status, returns the last one
+func waitStatus(t *testing.T, lp *LocalPlayground, name string, want model.StatusType) model.StatusType {
+	t.Helper()
+	var status model.StatusType
+	for i := 0; i < 50; i++ {
+		var err error
+		status, err = process(t, lp, name).Status(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == want {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return status
+}
+
+func TestOperations(t *testing.T) {
+	tests := []struct {
+		op   model.Operation
+		want model.StatusType
+		// wantUndone is status after the undo, zero if there is no undo
+		wantUndone model.StatusType
+	}{
+		{op: model.NewOperation(model.OperationTypePause), want: model.StatusTypePaused, wantUndone: model.StatusTypeWorking},
+		{op: model.NewOperation(model.OperationTypeResume), want: model.StatusTypeWorking},
+		{op: model.NewOperation(model.OperationTypeDestroy), want: model.StatusTypeDestroyed},
+		{op: model.NewOperation(model.OperationTypeStop), want: model.StatusTypeDestroyed},
+		{op: model.NewOperation(model.OperationTypeKill), want: model.StatusTypeDestroyed},
+		{op: model.Operation{Type: model.OperationTypeKill, Params: map[string]string{"signal": "SIGSTOP"}}, want: model.StatusTypePaused},
+		{op: model.NewOperation(model.OperationTypeRestart), want: model.StatusTypeWorking},
+		{op: model.NewOperation(model.OperationTypeStart), want: model.StatusTypeWorking},
+	}
+	for _, tt := range tests {
+		lp, stop := newTestPlayground(t)
+		before := process(t, lp, sleepConfig.Name)
+		undo, err := before.DoReversible(context.Background(), tt.op)
+		if err != nil {
+			t.Errorf("%s: %v", tt.op.Type, err)
+			stop()
+			continue
+		}
+		if status := waitStatus(t, lp, sleepConfig.Name, tt.want); status != tt.want {
+			t.Errorf("%s: status %s, want %s", tt.op.Type, status, tt.want)
+		}
+		after := process(t, lp, sleepConfig.Name)
+		if after.ID() != before.ID() {
+			t.Errorf("%s: id changed from %s to %s", tt.op.Type, before.ID(), after.ID())
+		}
+		if tt.op.Type == model.OperationTypeRestart && after.pid == before.pid {
+			t.Errorf("%s: pid %d didn't change", tt.op.Type, after.pid)
+		}
+		if (undo != nil) != (tt.wantUndone != 0) {
+			t.Errorf("%s: undo %v, want undo %v", tt.op.Type, undo != nil, tt.wantUndone != 0)
+		} else if undo != nil {
+			if err := undo.Undo(context.Background()); err != nil {
+				t.Errorf("%s: undo: %v", tt.op.Type, err)
+			}
+			if status := waitStatus(t, lp, sleepConfig.Name, tt.wantUndone); status != tt.wantUndone {
+				t.Errorf("%s: status after undo %s, want %s", tt.op.Type, status, tt.wantUndone)
+			}
+		}
+		stop()
+	}
+}
+
+// TestStartAfterKill checks that killed process keeps its id and can be started again
+func TestStartAfterKill(t *testing.T) {
+	lp, stop := newTestPlayground(t)
+	defer stop()
+	if err := process(t, lp, sleepConfig.Name).Do(context.Background(), model.NewOperation(model.OperationTypeKill)); err != nil {
+		t.Fatal(err)
+	}
+	if status := waitStatus(t, lp, sleepConfig.Name, model.StatusTypeDestroyed); status != model.StatusTypeDestroyed {
+		t.Fatalf("Status %s after kill", status)
+	}
+	killed := process(t, lp, sleepConfig.Name)
+	if killed.ID() != sleepConfig.Name {
+		t.Errorf("Id of killed process %s, want %s", killed.ID(), sleepConfig.Name)
+	}
+	if err := killed.Do(context.Background(), model.NewOperation(model.OperationTypePause)); err == nil {
+		t.Errorf("Paused process that is not running")
+	}
+	if err := killed.Do(context.Background(), model.NewOperation(model.OperationTypeStart)); err != nil {
+		t.Fatal(err)
+	}
+	if status := waitStatus(t, lp, sleepConfig.Name, model.StatusTypeWorking); status != model.StatusTypeWorking {
+		t.Errorf("Status %s after start", status)
+	}
+}
+
+func TestPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	tests := []struct {
+		name string
+		pid  string
+		// age is how long ago pid file was written
+		age  time.Duration
+		want model.StatusType
+	}{
+		{name: "running", pid: strconv.Itoa(cmd.Process.Pid), want: model.StatusTypeWorking},
+		// process started after the file was written has reused pid
+		{name: "reused", pid: strconv.Itoa(cmd.Process.Pid), age: time.Hour, want: model.StatusTypeDestroyed},
+		{name: "garbage", pid: "x", want: model.StatusTypeDestroyed},
+		{name: "missing", want: model.StatusTypeDestroyed},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".pid")
+		if tt.pid != "" {
+			if err := ioutil.WriteFile(path, []byte(tt.pid+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			written := time.Now().Add(-tt.age)
+			if err := os.Chtimes(path, written, written); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lp, stop := newTestPlayground(t, ProcessConfig{Name: tt.name, PidFile: path})
+		e := process(t, lp, tt.name)
+		if e.ID() != tt.name {
+			t.Errorf("%s: id %s, want %s", tt.name, e.ID(), tt.name)
+		}
+		status, err := e.Status(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.want {
+			t.Errorf("%s: status %s, want %s", tt.name, status, tt.want)
+		}
+		stop()
+	}
+}
+
+func TestMatch(t *testing.T) {
+	lp, stop := newTestPlayground(t, ProcessConfig{Name: "matched", Match: `^sleep 60$`})
+	defer stop()
+	entities, err := lp.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := process(t, lp, sleepConfig.Name).pid
+	ids := make(map[string]bool)
+	for _, e := range entities {
+		if ids[e.ID()] {
+			t.Errorf("Id %s is listed twice", e.ID())
+		}
+		ids[e.ID()] = true
+	}
+	if want := "matched/" + strconv.Itoa(pid); !ids[want] {
+		t.Errorf("Ids %v, want %s among them", ids, want)
+	}
+}
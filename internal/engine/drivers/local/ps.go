@@ -0,0 +1,120 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// psEntry is a process as reported by ps
+	psEntry struct {
+		pid   int
+		state string
+		args  string
+	}
+)
+
+// listProcesses returns all the processes of the machine.
+// ps is used instead of /proc, so it works on macOS too.
+func listProcesses() ([]psEntry, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "stat=", "-o", "args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing processes: %v", err)
+	}
+	res := make([]psEntry, 0)
+	self := os.Getpid()
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil || pid == self {
+			continue
+		}
+		res = append(res, psEntry{
+			pid:   pid,
+			state: fields[1],
+			args:  strings.Join(fields[2:], " "),
+		})
+	}
+	return res, nil
+}
+
+// processState returns state of the process (R, S, T, Z, ...),
+// empty string if there is no such process
+func processState(pid int) string {
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "stat=").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// processArgs returns command line of the process.
+// It is read from /proc where available, because
+// ps joins arguments with spaces.
+func processArgs(pid int, psArgs string) []string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err == nil && len(b) > 0 {
+		return strings.Split(string(bytes.TrimRight(b, "\x00")), "\x00")
+	}
+	return strings.Fields(psArgs)
+}
+
+// processDir returns working directory of the process, if known
+func processDir(pid int) string {
+	dir, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// processEnv returns environment of the process, if known
+func processEnv(pid int) []string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(bytes.TrimRight(b, "\x00")), "\x00")
+}
+
+// readPidFile returns pid written in the file. Pid of the process
+// started after the file was written is reused by another process,
+// as processes write pid files after they start.
+func readPidFile(path string) (int, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("Bad pid file %s: %v", path, err)
+	}
+	// start time has precision of a second, and may be off by
+	// a second more as it is counted from the boot time
+	if started, err := processStarted(pid); err == nil && started.After(fi.ModTime().Add(2*time.Second)) {
+		return 0, fmt.Errorf("Pid %d of %s belongs to process started after the file was written", pid, path)
+	}
+	return pid, nil
+}
+
+// processStarted returns time process was started at
+func processStarted(pid int) (time.Time, error) {
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "lstart=").Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("Mon Jan 2 15:04:05 2006", strings.Join(strings.Fields(string(out)), " "), time.Local)
+}
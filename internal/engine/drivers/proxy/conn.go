@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// proxyConn is a client connection proxied to upstream
+	proxyConn struct {
+		link     *link
+		client   net.Conn
+		upstream net.Conn
+		once     sync.Once
+		done     chan struct{}
+	}
+)
+
+const (
+	bufferSize = 32 * 1024
+	// holdCheckInterval is how often held data is checked for fault end
+	holdCheckInterval = 100 * time.Millisecond
+)
+
+// run proxies data in both directions until both sides are done
+// sending, or one of them fails
+func (pc *proxyConn) run() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		pc.pipe(pc.client, pc.upstream)
+		wg.Done()
+	}()
+	go func() {
+		pc.pipe(pc.upstream, pc.client)
+		wg.Done()
+	}()
+	wg.Wait()
+	pc.close(false)
+}
+
+// pipe forwards data from src to dst. When src is done sending,
+// dst is half-closed, so the peer can still send its response.
+// Connection is closed on errors.
+func (pc *proxyConn) pipe(src, dst net.Conn) {
+	buf := make([]byte, bufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if !pc.forward(dst, buf[:n]) {
+				pc.close(false)
+				return
+			}
+		}
+		if err == io.EOF {
+			if !closeWrite(dst) {
+				pc.close(false)
+			}
+			return
+		}
+		if err != nil {
+			pc.close(false)
+			return
+		}
+	}
+}
+
+// forward writes data to dst applying active faults,
+// returns false if connection should be closed
+func (pc *proxyConn) forward(dst net.Conn, data []byte) bool {
+	f, now := pc.link.activeFaults()
+	heldSince := now
+	for now.Before(f.timeout) {
+		if f.config.Timeout > 0 && now.Sub(heldSince) >= f.config.Timeout {
+			return false
+		}
+		if !pc.sleep(holdCheckInterval) {
+			return false
+		}
+		f, now = pc.link.activeFaults()
+	}
+	if now.Before(f.latency) {
+		latency := f.config.Latency
+		if f.config.Jitter > 0 {
+			latency += time.Duration(rand.Int63n(int64(f.config.Jitter)))
+		}
+		if !pc.sleep(latency) {
+			return false
+		}
+	}
+	sliceSize := len(data)
+	sliced := now.Before(f.slice) && f.config.SliceSize > 0
+	if sliced {
+		sliceSize = f.config.SliceSize
+	}
+	throttled := now.Before(f.throttle) && f.config.Rate > 0
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > sliceSize {
+			chunk = chunk[:sliceSize]
+		}
+		data = data[len(chunk):]
+		if _, err := dst.Write(chunk); err != nil {
+			return false
+		}
+		if throttled {
+			if !pc.sleep(time.Duration(int64(len(chunk)) * int64(time.Second) / f.config.Rate)) {
+				return false
+			}
+		}
+		if sliced && len(data) > 0 {
+			if !pc.sleep(f.config.SliceDelay) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sleep waits for duration, returns false if connection was closed meanwhile
+func (pc *proxyConn) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-pc.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// close closes both sides of the connection, with RST if reset is true
+func (pc *proxyConn) close(reset bool) {
+	pc.once.Do(func() {
+		close(pc.done)
+		if reset {
+			resetConn(pc.client)
+			resetConn(pc.upstream)
+			return
+		}
+		pc.client.Close()
+		pc.upstream.Close()
+	})
+}
+
+// closeWrite shuts down sending side of the connection,
+// returns false if connection can't be half-closed
+func closeWrite(conn net.Conn) bool {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		return tcpConn.CloseWrite() == nil
+	}
+	return false
+}
+
+// resetConn closes connection so that RST is sent to the peer
+func resetConn(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
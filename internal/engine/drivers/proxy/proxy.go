@@ -0,0 +1,378 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// LinkConfig describes one proxied link
+	LinkConfig struct {
+		Name     string
+		Listen   string
+		Upstream string
+		Labels   map[string]string
+	}
+
+	// FaultConfig configures faults injected into the links
+	FaultConfig struct {
+		// Latency added to each chunk of data by slowdown
+		Latency time.Duration
+		// Jitter is maximum random addition to Latency
+		Jitter time.Duration
+		// Rate is bandwidth in bytes per second set by throttle
+		Rate int64
+		// SliceSize is size of the slices data is cut to by slice
+		SliceSize int
+		// SliceDelay is delay between slices
+		SliceDelay time.Duration
+		// Timeout after which connections are closed by timeout,
+		// if zero data is held until fault ends
+		Timeout time.Duration
+		// Duration of the faults
+		Duration time.Duration
+	}
+
+	// ProxyPlayground runs TCP proxies in-process. Links between
+	// listen and upstream addresses are entities that faults are
+	// injected into, so no root or tc is needed.
+	ProxyPlayground struct {
+		links []*link
+	}
+
+	// link is a TCP proxy from listen address to upstream
+	link struct {
+		config   LinkConfig
+		mu       sync.Mutex
+		listener net.Listener
+		conns    map[*proxyConn]struct{}
+		faults   faults
+	}
+
+	// faults holds end times of the active faults
+	faults struct {
+		latency  time.Time
+		throttle time.Time
+		timeout  time.Time
+		reset    time.Time
+		slice    time.Time
+		// config of the faults, Faults with parameters
+		// of the last operation applied
+		config FaultConfig
+	}
+)
+
+// Faults is used by the operations on the links
+var Faults = FaultConfig{
+	Latency:    500 * time.Millisecond,
+	Jitter:     100 * time.Millisecond,
+	Rate:       128 * 1024,
+	SliceSize:  64,
+	SliceDelay: 10 * time.Millisecond,
+	Duration:   time.Minute,
+}
+
+// Parameters of the link operations that differ from the standard ones
+var (
+	paramRate    = model.ParamSpec{Name: "rate", Type: model.ParamTypeInt, Description: "Bandwidth in bytes per second", Positive: true}
+	paramTimeout = model.ParamSpec{Name: "timeout", Type: model.ParamTypeDuration, Description: "Time after which held connections are closed"}
+)
+
+// ParseLinkConfig parses link in name=listen->upstream form
+func ParseLinkConfig(s string) (LinkConfig, error) {
+	nameAddrs := strings.SplitN(s, "=", 2)
+	if len(nameAddrs) != 2 {
+		return LinkConfig{}, fmt.Errorf("Link %q should be in name=listen->upstream form", s)
+	}
+	addrs := strings.SplitN(nameAddrs[1], "->", 2)
+	if len(addrs) != 2 || nameAddrs[0] == "" || addrs[0] == "" || addrs[1] == "" {
+		return LinkConfig{}, fmt.Errorf("Link %q should be in name=listen->upstream form", s)
+	}
+	return LinkConfig{
+		Name:     nameAddrs[0],
+		Listen:   addrs[0],
+		Upstream: addrs[1],
+	}, nil
+}
+
+// NewProxyPlayground creates a new proxy driver and starts listening on the links
+func NewProxyPlayground(links []LinkConfig) (*ProxyPlayground, error) {
+	pp := &ProxyPlayground{}
+	for _, lc := range links {
+		l := &link{
+			config: lc,
+			conns:  make(map[*proxyConn]struct{}),
+		}
+		if err := l.start(); err != nil {
+			pp.Close()
+			return nil, err
+		}
+		pp.links = append(pp.links, l)
+	}
+	return pp, nil
+}
+
+// Capabilities returns operations the driver can do and their parameters
+func (pp *ProxyPlayground) Capabilities() []model.OperationSpec {
+	link := []model.EntityType{model.EntityTypeNetworkLink}
+	return []model.OperationSpec{
+		{Operation: model.OperationTypeStart, Entities: link},
+		{Operation: model.OperationTypeStop, Entities: link},
+		{Operation: model.OperationTypeDestroy, Entities: link},
+		{Operation: model.OperationTypeResume, Entities: link},
+		{Operation: model.OperationTypeSlowdown, Entities: link, Params: []model.ParamSpec{model.ParamDuration, model.ParamDelay, model.ParamJitter}},
+		{Operation: model.OperationTypeThrottle, Entities: link, Params: []model.ParamSpec{model.ParamDuration, paramRate}},
+		{Operation: model.OperationTypeTimeout, Entities: link, Params: []model.ParamSpec{model.ParamDuration, paramTimeout}},
+		{Operation: model.OperationTypePause, Entities: link, Params: []model.ParamSpec{model.ParamDuration, paramTimeout}},
+		{Operation: model.OperationTypeSlice, Entities: link, Params: []model.ParamSpec{model.ParamDuration}},
+		{Operation: model.OperationTypeReset, Entities: link, Params: []model.ParamSpec{model.ParamDuration}},
+	}
+}
+
+// Entities returns a list of all the links
+func (pp *ProxyPlayground) Entities() ([]model.Entity, error) {
+	res := make([]model.Entity, 0, len(pp.links))
+	for _, l := range pp.links {
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// Close stops all the links
+func (pp *ProxyPlayground) Close() {
+	for _, l := range pp.links {
+		l.stop()
+	}
+}
+
+func (l *link) ID() string {
+	return l.config.Name
+}
+
+func (l *link) Name() string {
+	return l.config.Name
+}
+
+func (l *link) Labels() map[string]string {
+	labels := map[string]string{
+		"proxy.listen":   l.config.Listen,
+		"proxy.upstream": l.config.Upstream,
+	}
+	for k, v := range l.config.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (l *link) Parent() model.Entity {
+	return nil
+}
+
+func (l *link) Childs() []model.Entity {
+	return nil
+}
+
+func (l *link) Type() model.EntityType {
+	return model.EntityTypeNetworkLink
+}
+
+func (l *link) Do(ctx context.Context, operation model.Operation) error {
+	config := Faults
+	config.Duration = operation.Duration(model.ParamDuration.Name, Faults.Duration)
+	config.Latency = operation.Duration(model.ParamDelay.Name, Faults.Latency)
+	config.Jitter = operation.Duration(model.ParamJitter.Name, Faults.Jitter)
+	config.Rate = int64(operation.Int(paramRate.Name, int(Faults.Rate)))
+	config.Timeout = operation.Duration(paramTimeout.Name, Faults.Timeout)
+	until := time.Now().Add(config.Duration)
+	switch operation.Type {
+	case model.OperationTypeStart:
+		return l.start()
+	case model.OperationTypeStop, model.OperationTypeDestroy:
+		l.stop()
+		return nil
+	case model.OperationTypeResume:
+		l.mu.Lock()
+		l.faults = faults{}
+		l.mu.Unlock()
+		return nil
+	case model.OperationTypeSlowdown:
+		l.setFault(&l.faults.latency, until, config)
+	case model.OperationTypeThrottle:
+		if config.Rate <= 0 {
+			return fmt.Errorf("Bad throttle rate %d", config.Rate)
+		}
+		l.setFault(&l.faults.throttle, until, config)
+	case model.OperationTypeTimeout, model.OperationTypePause:
+		l.setFault(&l.faults.timeout, until, config)
+	case model.OperationTypeSlice:
+		if config.SliceSize <= 0 {
+			return fmt.Errorf("Bad slice size %d", config.SliceSize)
+		}
+		l.setFault(&l.faults.slice, until, config)
+	case model.OperationTypeReset:
+		l.setFault(&l.faults.reset, until, config)
+		l.resetConns()
+	default:
+		return model.ErrOperationNotSupported
+	}
+	glog.Infof("Injected %s into link %s for %s", operation, l.config.Name, config.Duration)
+	return nil
+}
+
+// DoReversible does operation, returning handle that reverts it.
+// Undo clears only the fault injected by the operation.
+func (l *link) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if err := l.Do(ctx, operation); err != nil {
+		return nil, err
+	}
+	var fault *time.Time
+	switch operation.Type {
+	case model.OperationTypeStop, model.OperationTypeDestroy:
+		return model.NewUndo("start", func(ctx context.Context) error {
+			return l.start()
+		}), nil
+	case model.OperationTypeSlowdown:
+		fault = &l.faults.latency
+	case model.OperationTypeThrottle:
+		fault = &l.faults.throttle
+	case model.OperationTypeTimeout, model.OperationTypePause:
+		fault = &l.faults.timeout
+	case model.OperationTypeSlice:
+		fault = &l.faults.slice
+	case model.OperationTypeReset:
+		fault = &l.faults.reset
+	default:
+		return nil, nil
+	}
+	return model.NewUndo("clear "+operation.Type.String(), func(ctx context.Context) error {
+		l.mu.Lock()
+		*fault = time.Time{}
+		l.mu.Unlock()
+		glog.Infof("Cleared %s of link %s", operation.Type, l.config.Name)
+		return nil
+	}), nil
+}
+
+func (l *link) Status(ctx context.Context) (model.StatusType, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.listener == nil {
+		return model.StatusTypeStopped, nil
+	}
+	now := time.Now()
+	if now.Before(l.faults.timeout) || now.Before(l.faults.reset) {
+		return model.StatusTypePaused, nil
+	}
+	if now.Before(l.faults.latency) || now.Before(l.faults.throttle) || now.Before(l.faults.slice) {
+		return model.StatusTypeSlow, nil
+	}
+	return model.StatusTypeWorking, nil
+}
+
+func (l *link) setFault(fault *time.Time, until time.Time, config FaultConfig) {
+	l.mu.Lock()
+	*fault = until
+	l.faults.config = config
+	l.mu.Unlock()
+}
+
+// activeFaults returns copy of the faults and current time
+func (l *link) activeFaults() (faults, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.faults, time.Now()
+}
+
+func (l *link) start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.listener != nil {
+		return nil
+	}
+	listener, err := net.Listen("tcp", l.config.Listen)
+	if err != nil {
+		return err
+	}
+	l.listener = listener
+	glog.Infof("Link %s listening on %s, upstream %s", l.config.Name, listener.Addr(), l.config.Upstream)
+	go l.acceptLoop(listener)
+	return nil
+}
+
+// stop closes listener and all the connections
+func (l *link) stop() {
+	l.mu.Lock()
+	listener := l.listener
+	l.listener = nil
+	conns := l.conns
+	l.conns = make(map[*proxyConn]struct{})
+	l.mu.Unlock()
+	if listener != nil {
+		listener.Close()
+		glog.Infof("Link %s stopped", l.config.Name)
+	}
+	for pc := range conns {
+		pc.close(false)
+	}
+}
+
+// resetConns closes all the connections sending RST to peers
+func (l *link) resetConns() {
+	l.mu.Lock()
+	conns := l.conns
+	l.conns = make(map[*proxyConn]struct{})
+	l.mu.Unlock()
+	for pc := range conns {
+		pc.close(true)
+	}
+}
+
+func (l *link) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			glog.V(2).Infof("Link %s stopped accepting: %v", l.config.Name, err)
+			return
+		}
+		go l.handle(conn)
+	}
+}
+
+func (l *link) handle(client net.Conn) {
+	f, now := l.activeFaults()
+	if now.Before(f.reset) {
+		resetConn(client)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", l.config.Upstream, 5*time.Second)
+	if err != nil {
+		glog.Infof("Link %s can't connect to upstream %s: %v", l.config.Name, l.config.Upstream, err)
+		resetConn(client)
+		return
+	}
+	pc := &proxyConn{
+		link:     l,
+		client:   client,
+		upstream: upstream,
+		done:     make(chan struct{}),
+	}
+	l.mu.Lock()
+	if l.listener == nil {
+		l.mu.Unlock()
+		pc.close(false)
+		return
+	}
+	l.conns[pc] = struct{}{}
+	l.mu.Unlock()
+	pc.run()
+	l.mu.Lock()
+	delete(l.conns, pc)
+	l.mu.Unlock()
+}
@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// startUpstream starts loopback server handling connections
+// with handler, returns its address and function stopping it
+func startUpstream(t *testing.T, handler func(net.Conn)) (string, func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// echo sends back everything it gets
+func echo(conn net.Conn) {
+	io.Copy(conn, conn)
+}
+
+// respondAfterEOF reads request till client half-closes, then responds
+func respondAfterEOF(conn net.Conn) {
+	req, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+	conn.Write([]byte("got:" + string(req)))
+}
+
+// newTestLink starts link on loopback proxied to upstream
+// server with the handler, returns it and function stopping both
+func newTestLink(t *testing.T, handler func(net.Conn)) (*link, func()) {
+	t.Helper()
+	upstream, stopUpstream := startUpstream(t, handler)
+	pp, err := NewProxyPlayground([]LinkConfig{{Name: "test", Listen: "127.0.0.1:0", Upstream: upstream}})
+	if err != nil {
+		stopUpstream()
+		t.Fatal(err)
+	}
+	return pp.links[0], func() {
+		pp.Close()
+		stopUpstream()
+	}
+}
+
+// dial connects to the link's listen address, connection
+// should be closed by the caller
+func (l *link) dial(t *testing.T) net.Conn {
+	t.Helper()
+	l.mu.Lock()
+	addr := l.listener.Addr().String()
+	l.mu.Unlock()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// roundTrip sends message through connection to echo upstream and reads it back
+func roundTrip(conn net.Conn, msg string) (string, error) {
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return "", err
+	}
+	buf := make([]byte, len(msg))
+	_, err := io.ReadFull(conn, buf)
+	return string(buf), err
+}
+
+func TestParseLinkConfig(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    LinkConfig
+		wantErr bool
+	}{
+		{in: "db=:5433->db:5432", want: LinkConfig{Name: "db", Listen: ":5433", Upstream: "db:5432"}},
+		{in: "api=127.0.0.1:80->10.0.0.1:8080", want: LinkConfig{Name: "api", Listen: "127.0.0.1:80", Upstream: "10.0.0.1:8080"}},
+		{in: ":5433->db:5432", wantErr: true},
+		{in: "db=:5433", wantErr: true},
+		{in: "db=->db:5432", wantErr: true},
+		{in: "db=:5433->", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLinkConfig(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLinkConfig(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got.Name != tt.want.Name || got.Listen != tt.want.Listen || got.Upstream != tt.want.Upstream) {
+			t.Errorf("ParseLinkConfig(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestProxyForwards(t *testing.T) {
+	l, stop := newTestLink(t, echo)
+	defer stop()
+	conn := l.dial(t)
+	defer conn.Close()
+	for _, msg := range []string{"hello", strings.Repeat("x", 3*bufferSize)} {
+		got, err := roundTrip(conn, msg)
+		if err != nil || got != msg {
+			t.Fatalf("roundTrip of %d bytes = %d bytes, %v", len(msg), len(got), err)
+		}
+	}
+}
+
+// TestProxyHalfClose checks that response is delivered to the client
+// that half-closed connection after sending the request
+func TestProxyHalfClose(t *testing.T) {
+	l, stop := newTestLink(t, respondAfterEOF)
+	defer stop()
+	conn := l.dial(t)
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "got:ping" {
+		t.Errorf("Got response %q, want %q", resp, "got:ping")
+	}
+}
+
+func TestProxyFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     model.OperationType
+		params map[string]string
+		msg    string
+		// number of round trips, 1 if zero
+		rounds int
+		// minimum time round trips take
+		minTime time.Duration
+		// round trip should fail
+		wantErr bool
+		status  model.StatusType
+	}{
+		{
+			name:    "slowdown",
+			op:      model.OperationTypeSlowdown,
+			params:  map[string]string{"delay": "200ms", "jitter": "0s"},
+			msg:     "hello",
+			minTime: 400 * time.Millisecond,
+			status:  model.StatusTypeSlow,
+		},
+		{
+			name:   "throttle",
+			op:     model.OperationTypeThrottle,
+			params: map[string]string{"rate": "2000"},
+			msg:    strings.Repeat("x", 600),
+			// data is delayed after it is sent, at the rate
+			rounds:  2,
+			minTime: 300 * time.Millisecond,
+			status:  model.StatusTypeSlow,
+		},
+		{
+			name:    "slice",
+			op:      model.OperationTypeSlice,
+			msg:     strings.Repeat("x", 10*Faults.SliceSize),
+			minTime: 9 * Faults.SliceDelay,
+			status:  model.StatusTypeSlow,
+		},
+		{
+			name:    "timeout",
+			op:      model.OperationTypeTimeout,
+			params:  map[string]string{"timeout": "200ms"},
+			msg:     "hello",
+			minTime: 200 * time.Millisecond,
+			wantErr: true,
+			status:  model.StatusTypePaused,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, stop := newTestLink(t, echo)
+			defer stop()
+			conn := l.dial(t)
+			defer conn.Close()
+			op := model.Operation{Type: tt.op, Params: tt.params}
+			if err := l.Do(context.Background(), op); err != nil {
+				t.Fatal(err)
+			}
+			if status, _ := l.Status(context.Background()); status != tt.status {
+				t.Errorf("Status = %s, want %s", status, tt.status)
+			}
+			start := time.Now()
+			for i := 0; i < tt.rounds || i == 0; i++ {
+				got, err := roundTrip(conn, tt.msg)
+				if tt.wantErr != (err != nil) {
+					t.Fatalf("roundTrip error = %v, want error %v", err, tt.wantErr)
+				}
+				if !tt.wantErr && got != tt.msg {
+					t.Errorf("roundTrip got %d bytes, want %d", len(got), len(tt.msg))
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed < tt.minTime {
+				t.Errorf("roundTrip took %s, want at least %s", elapsed, tt.minTime)
+			}
+		})
+	}
+}
+
+func TestProxyReset(t *testing.T) {
+	l, stop := newTestLink(t, echo)
+	defer stop()
+	conn := l.dial(t)
+	defer conn.Close()
+	if _, err := roundTrip(conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Do(context.Background(), model.NewOperation(model.OperationTypeReset)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roundTrip(conn, "hello"); err == nil {
+		t.Error("Connection open before reset still works")
+	}
+	conn = l.dial(t)
+	defer conn.Close()
+	if _, err := roundTrip(conn, "hello"); err == nil {
+		t.Error("Connection opened during reset works")
+	}
+}
+
+func TestProxyUndo(t *testing.T) {
+	l, stop := newTestLink(t, echo)
+	defer stop()
+	undo, err := l.DoReversible(context.Background(), model.Operation{
+		Type:   model.OperationTypeSlowdown,
+		Params: map[string]string{"delay": "1s"},
+	})
+	if err != nil || undo == nil {
+		t.Fatalf("DoReversible = %v, %v", undo, err)
+	}
+	if err := undo.Undo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := l.Status(context.Background()); status != model.StatusTypeWorking {
+		t.Errorf("Status after undo = %s, want %s", status, model.StatusTypeWorking)
+	}
+	conn := l.dial(t)
+	defer conn.Close()
+	start := time.Now()
+	if _, err := roundTrip(conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("roundTrip after undo took %s", elapsed)
+	}
+}
+
+func TestProxyStopStart(t *testing.T) {
+	l, stop := newTestLink(t, echo)
+	defer stop()
+	conn := l.dial(t)
+	defer conn.Close()
+	if err := l.Do(context.Background(), model.NewOperation(model.OperationTypeStop)); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := l.Status(context.Background()); status != model.StatusTypeStopped {
+		t.Errorf("Status after stop = %s, want %s", status, model.StatusTypeStopped)
+	}
+	if _, err := roundTrip(conn, "hello"); err == nil {
+		t.Error("Connection works after link is stopped")
+	}
+	if err := l.Do(context.Background(), model.NewOperation(model.OperationTypeStart)); err != nil {
+		t.Fatal(err)
+	}
+	conn = l.dial(t)
+	defer conn.Close()
+	if got, err := roundTrip(conn, "hello"); err != nil || got != "hello" {
+		t.Errorf("roundTrip after start = %q, %v", got, err)
+	}
+}
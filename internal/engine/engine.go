@@ -1,49 +1,229 @@
 package engine
 
-import "github.com/livepeer/swarm-chaos/internal/model"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
 
 type (
+	// ChaosEngine aggregates several named playgrounds into one.
+	// Its entities' names and ids are qualified by the playground
+	// name, so they are unique across playgrounds.
 	ChaosEngine struct {
+		names       []string
 		playgrounds []model.Playground
 	}
+
+	// playgroundEntity is an entity of one of the engine's playgrounds
+	playgroundEntity struct {
+		model.Entity
+		playground string
+	}
 )
 
+// playgroundSeparator separates playground name from entity's name
+const playgroundSeparator = ":"
+
 func NewChaosEngine() *ChaosEngine {
 	ce := &ChaosEngine{}
 	return ce
 }
 
-func (ce *ChaosEngine) AddPlayground(playground model.Playground) {
+// AddPlayground adds playground under the name
+func (ce *ChaosEngine) AddPlayground(name string, playground model.Playground) error {
+	if name == "" || strings.Contains(name, playgroundSeparator) {
+		return fmt.Errorf("Bad playground name %q", name)
+	}
+	for _, n := range ce.names {
+		if n == name {
+			return fmt.Errorf("Playground %s already added", name)
+		}
+	}
+	ce.names = append(ce.names, name)
 	ce.playgrounds = append(ce.playgrounds, playground)
+	return nil
+}
+
+// Playgrounds returns names of the playgrounds
+func (ce *ChaosEngine) Playgrounds() []string {
+	return append([]string(nil), ce.names...)
 }
 
 func (ce *ChaosEngine) Entities() ([]model.Entity, error) {
 	res := make([]model.Entity, 0)
-	for _, driver := range ce.playgrounds {
+	for i, driver := range ce.playgrounds {
 		entities, err := driver.Entities()
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Playground %s: %v", ce.names[i], err)
 		}
 		for _, e := range entities {
-			res = append(res, e)
+			res = append(res, wrapEntity(ce.names[i], e))
 		}
 	}
 	return res, nil
 }
 
-func (ce *ChaosEngine) EntitiesByLabel(key, value string) ([]model.Entity, error) {
+// Query returns entities of the playgrounds selected by the query.
+// Playgrounds that don't support queries list all their entities,
+// filtered by status if only running ones are asked for.
+func (ce *ChaosEngine) Query(q model.Query) ([]model.Entity, error) {
 	res := make([]model.Entity, 0)
-	for _, driver := range ce.playgrounds {
-		entities, err := driver.Entities()
+	for i, playground := range ce.playgrounds {
+		name := ce.names[i]
+		if q.Playground != "" && q.Playground != name {
+			continue
+		}
+		pq := q
+		pq.Playground = ""
+		if strings.HasPrefix(q.Name, name+playgroundSeparator) {
+			pq.Name = strings.TrimPrefix(q.Name, name+playgroundSeparator)
+		} else if strings.Contains(q.Name, playgroundSeparator) {
+			// pattern for qualified names, may match any playground
+			pq.Name = ""
+		}
+		querier, isQuerier := playground.(model.Querier)
+		var entities []model.Entity
+		var err error
+		if isQuerier {
+			entities, err = querier.Query(pq)
+		} else {
+			entities, err = playground.Entities()
+		}
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Playground %s: %v", name, err)
 		}
 		for _, e := range entities {
-			labels := e.Labels()
-			if labels[key] == value {
-				res = append(res, e)
+			if !isQuerier && !matchQuery(e, &pq) {
+				continue
 			}
+			res = append(res, wrapEntity(name, e))
 		}
 	}
 	return res, nil
 }
+
+// matchQuery filters entities of playgrounds that don't support queries.
+// Status is checked last, as it may be expensive.
+func matchQuery(e model.Entity, q *model.Query) bool {
+	if !q.HasType(e.Type()) {
+		return false
+	}
+	labels := e.Labels()
+	for k, v := range q.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	if !q.Running {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), StatusTimeout)
+	defer cancel()
+	status, err := e.Status(ctx)
+	return err == nil && (status == model.StatusTypeWorking || status == model.StatusTypeSlow)
+}
+
+// NotifyStatus makes engine call listener on status changes
+// observed by the playgrounds that can observe them
+func (ce *ChaosEngine) NotifyStatus(listener func(model.StatusChange)) {
+	for i, playground := range ce.playgrounds {
+		notifier, ok := playground.(model.StatusNotifier)
+		if !ok {
+			continue
+		}
+		name := ce.names[i]
+		notifier.NotifyStatus(func(change model.StatusChange) {
+			change.EntityID = name + playgroundSeparator + change.EntityID
+			change.Name = name + playgroundSeparator + change.Name
+			listener(change)
+		})
+	}
+}
+
+// Health returns health of the nodes of all the playgrounds that
+// track it, each with name of its playground set
+func (ce *ChaosEngine) Health() []model.NodeHealth {
+	res := make([]model.NodeHealth, 0)
+	for i, playground := range ce.playgrounds {
+		reporter, ok := playground.(model.HealthReporter)
+		if !ok {
+			continue
+		}
+		for _, h := range reporter.Health() {
+			h.Playground = ce.names[i]
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+func (ce *ChaosEngine) EntitiesByLabel(key, value string) ([]model.Entity, error) {
+	res := make([]model.Entity, 0)
+	entities, err := ce.Entities()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		labels := e.Labels()
+		if labels[key] == value {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func wrapEntity(playground string, e model.Entity) model.Entity {
+	if e == nil {
+		return nil
+	}
+	return &playgroundEntity{
+		Entity:     e,
+		playground: playground,
+	}
+}
+
+// Playground returns name of the entity's playground
+func (pe *playgroundEntity) Playground() string {
+	return pe.playground
+}
+
+// LocalName returns name of the entity inside its playground
+func (pe *playgroundEntity) LocalName() string {
+	return pe.Entity.Name()
+}
+
+func (pe *playgroundEntity) ID() string {
+	return pe.playground + playgroundSeparator + pe.Entity.ID()
+}
+
+func (pe *playgroundEntity) Name() string {
+	return pe.playground + playgroundSeparator + pe.Entity.Name()
+}
+
+func (pe *playgroundEntity) Parent() model.Entity {
+	return wrapEntity(pe.playground, pe.Entity.Parent())
+}
+
+func (pe *playgroundEntity) Childs() []model.Entity {
+	childs := pe.Entity.Childs()
+	if childs == nil {
+		return nil
+	}
+	res := make([]model.Entity, 0, len(childs))
+	for _, c := range childs {
+		res = append(res, wrapEntity(pe.playground, c))
+	}
+	return res
+}
+
+// DoReversible does operation on the entity, returning undo
+// handle if entity's playground can revert the operation
+func (pe *playgroundEntity) DoReversible(ctx context.Context, operation model.Operation) (model.Undo, error) {
+	if reversible, ok := pe.Entity.(model.Reversible); ok {
+		return reversible.DoReversible(ctx, operation)
+	}
+	return nil, pe.Entity.Do(ctx, operation)
+}
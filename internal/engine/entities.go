@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// EntityInfo describes entity for the API
+	EntityInfo struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		Playground string `json:"playground,omitempty"`
+		// Parent is id of the parent entity
+		Parent string `json:"parent,omitempty"`
+		// Node is name of the vm entity runs on
+		Node   string            `json:"node,omitempty"`
+		Labels map[string]string `json:"labels,omitempty"`
+		// Status is only reported on request, as it may be expensive
+		Status      string `json:"status,omitempty"`
+		StatusError string `json:"status_error,omitempty"`
+	}
+)
+
+// ErrEntityNotFound is returned for ids of entities playground doesn't have
+var ErrEntityNotFound = errors.New("Entity not found")
+
+// statusWorkers limits number of statuses got at once
+const statusWorkers = 8
+
+func newEntityInfo(e model.Entity) EntityInfo {
+	info := EntityInfo{
+		ID:     e.ID(),
+		Name:   e.Name(),
+		Type:   e.Type().String(),
+		Labels: e.Labels(),
+	}
+	if pe, ok := e.(*playgroundEntity); ok {
+		info.Playground = pe.Playground()
+	}
+	if parent := e.Parent(); parent != nil {
+		info.Parent = parent.ID()
+	}
+	for p := e.Parent(); p != nil; p = p.Parent() {
+		if p.Type() == model.EntityTypeVM {
+			info.Node = p.Name()
+			break
+		}
+	}
+	return info
+}
+
+// setStatus gets status of the entity into info
+func (sc *Scheduler) setStatus(ctx context.Context, e model.Entity, info *EntityInfo) {
+	status, err := sc.status(ctx, e)
+	if err != nil {
+		info.StatusError = err.Error()
+	} else {
+		info.Status = status.String()
+	}
+}
+
+// Entities returns entities matching the selector, of any state
+// unless selector says otherwise. Statuses of the entities are
+// got concurrently if withStatus is true.
+func (sc *Scheduler) Entities(ctx context.Context, selector Selector, withStatus bool) ([]EntityInfo, error) {
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	if selector.State == "" {
+		selector.State = stateAny
+	}
+	entities, err := sc.entitiesBySelector(&selector, model.OperationTypeDestroy)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]EntityInfo, len(entities))
+	for i, e := range entities {
+		res[i] = newEntityInfo(e)
+	}
+	if !withStatus {
+		return res, nil
+	}
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for w := 0; w < statusWorkers && w < len(entities); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				sc.setStatus(ctx, entities[i], &res[i])
+			}
+		}()
+	}
+	for i := range entities {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return res, nil
+}
+
+// Entity returns entity with the id, its status included
+func (sc *Scheduler) Entity(ctx context.Context, id string) (EntityInfo, error) {
+	e, err := sc.findEntity(id)
+	if err != nil {
+		return EntityInfo{}, err
+	}
+	info := newEntityInfo(e)
+	sc.setStatus(ctx, e, &info)
+	return info, nil
+}
+
+// findEntity returns entity with the id. Processes aren't listed by
+// all playgrounds, so they are also looked for among childs of the
+// container their id starts with.
+func (sc *Scheduler) findEntity(id string) (model.Entity, error) {
+	entities, err := sc.playground.Entities()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		if e.ID() == id {
+			return e, nil
+		}
+	}
+	for _, e := range entities {
+		if e.Type() != model.EntityTypeContainer || !strings.HasPrefix(id, e.ID()+"/") {
+			continue
+		}
+		for _, c := range e.Childs() {
+			if c.Type() == model.EntityTypeProcess && c.ID() == id {
+				return c, nil
+			}
+		}
+	}
+	return nil, ErrEntityNotFound
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// EventType is type of the journal event
+	EventType string
+
+	// Event is a record of what happened to the playground
+	Event struct {
+		Time time.Time `json:"time"`
+		Type EventType `json:"type"`
+		// Task is id of the task event is caused by, -1 if none
+		Task      int    `json:"task"`
+		EntityID  string `json:"entity_id,omitempty"`
+		Entity    string `json:"entity,omitempty"`
+		Operation string `json:"operation,omitempty"`
+		Message   string `json:"message,omitempty"`
+	}
+
+	// Journal keeps the latest events
+	Journal struct {
+		mu sync.Mutex
+		// size is maximum number of events kept, unlimited if zero
+		size   int
+		events []Event
+	}
+)
+
+const (
+	// EventOperation is an operation done on an entity
+	EventOperation EventType = "operation"
+	// EventError is an operation or listing that failed
+	EventError EventType = "error"
+	// EventRefusal is an operation not done because of the task's limit
+	EventRefusal EventType = "refusal"
+	// EventRecovery is an affected entity that is working again or gone
+	EventRecovery EventType = "recovery"
+	// EventStatus is a status change observed by the playground
+	EventStatus EventType = "status"
+	// EventRevert is an operation reverted through its undo handle
+	EventRevert EventType = "revert"
+)
+
+// journalSize is number of events kept by the scheduler
+const journalSize = 1000
+
+// NewJournal creates a journal keeping size latest events,
+// or all of them if size is zero
+func NewJournal(size int) *Journal {
+	return &Journal{size: size}
+}
+
+// Add adds event to the journal, dropping the oldest one if it is full
+func (j *Journal) Add(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, e)
+	if j.size > 0 && len(j.events) > j.size {
+		j.events = append(j.events[:0], j.events[len(j.events)-j.size:]...)
+	}
+}
+
+// Events returns events in order they were added
+func (j *Journal) Events() []Event {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Event(nil), j.events...)
+}
+
+func (e Event) String() string {
+	str := fmt.Sprintf("%s %-9s", e.Time.Format(time.RFC3339), e.Type)
+	if e.Task >= 0 {
+		str += fmt.Sprintf(" task:%d", e.Task)
+	}
+	if e.Operation != "" {
+		str += " " + e.Operation
+	}
+	if e.Entity != "" {
+		str += " " + e.Entity
+	}
+	if e.Message != "" {
+		str += ": " + e.Message
+	}
+	return str
+}
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"encoding"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// schemaGenerator makes JSON schemas of Go types,
+	// named struct types go to the components
+	schemaGenerator struct {
+		schemas map[string]interface{}
+	}
+
+	jsonObject map[string]interface{}
+)
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// openAPIDocument generates OpenAPI document describing the routes
+func openAPIDocument(routes []route) jsonObject {
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+	errorResponse := jsonObject{
+		"description": "Error",
+		"content":     jsonObject{"application/json": jsonObject{"schema": g.schema(reflect.TypeOf(APIError{}))}},
+	}
+	paths := make(map[string]jsonObject)
+	for _, rt := range routes {
+		op := jsonObject{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+		}
+		parameters := make([]jsonObject, 0)
+		for _, part := range strings.Split(rt.path, "/") {
+			if !strings.HasPrefix(part, "{") {
+				continue
+			}
+			name := strings.Trim(part, "{}")
+			schema := jsonObject{"type": "string"}
+			if name == "id" {
+				schema = jsonObject{"type": "integer"}
+			}
+			parameters = append(parameters, jsonObject{"name": name, "in": "path", "required": true, "schema": schema})
+		}
+		names := make([]string, 0, len(rt.query))
+		for name := range rt.query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			parameters = append(parameters, jsonObject{"name": name, "in": "query", "description": rt.query[name], "schema": jsonObject{"type": "string"}})
+		}
+		if len(parameters) > 0 {
+			op["parameters"] = parameters
+		}
+		if rt.request != nil {
+			op["requestBody"] = jsonObject{
+				"required": true,
+				"content":  jsonObject{"application/json": jsonObject{"schema": g.schema(reflect.TypeOf(rt.request))}},
+			}
+		}
+		response := jsonObject{"description": http.StatusText(rt.status)}
+		if rt.response != nil {
+			response["content"] = jsonObject{"application/json": jsonObject{"schema": g.schema(reflect.TypeOf(rt.response))}}
+		}
+		op["responses"] = jsonObject{
+			strconv.Itoa(rt.status): response,
+			"default":               errorResponse,
+		}
+		path := apiPrefix + rt.path
+		if paths[path] == nil {
+			paths[path] = make(jsonObject)
+		}
+		paths[path][strings.ToLower(rt.method)] = op
+	}
+	return jsonObject{
+		"openapi": "3.0.3",
+		"info": jsonObject{
+			"title":   "Swarm Chaos API",
+			"version": model.SwarmChaosVersion,
+		},
+		"paths":      paths,
+		"components": jsonObject{"schemas": g.schemas},
+	}
+}
+
+// operationID makes id of the route like getTasksId
+func operationID(rt route) string {
+	id := strings.ToLower(rt.method)
+	for _, part := range strings.FieldsFunc(rt.path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.' || r == '_'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// schema returns schema of the type, reference for named structs
+func (g *schemaGenerator) schema(t reflect.Type) jsonObject {
+	if t == timeType {
+		return jsonObject{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return jsonObject{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return jsonObject{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, has := g.schemas[name]; !has {
+			// set before generating, so recursive types refer to themselves
+			g.schemas[name] = jsonObject{}
+			g.schemas[name] = g.structSchema(t)
+		}
+		return jsonObject{"$ref": "#/components/schemas/" + name}
+	}
+	return jsonObject{}
+}
+
+// structSchema returns schema of the struct's JSON fields,
+// fields without omitempty are required
+func (g *schemaGenerator) structSchema(t reflect.Type) jsonObject {
+	properties := make(jsonObject)
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+		omitempty := false
+		for _, opt := range tag[1:] {
+			omitempty = omitempty || opt == "omitempty"
+		}
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	schema := jsonObject{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
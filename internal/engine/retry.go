@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// RetryConfig configures retries of the transient errors
+	RetryConfig struct {
+		// Attempts is maximum number of attempts, 1 to not retry
+		Attempts int
+		// Backoff is delay before the first retry, doubled on every next one
+		Backoff time.Duration
+		// MaxBackoff caps the delay
+		MaxBackoff time.Duration
+	}
+)
+
+// Retry is used to retry listing entities and operations
+var Retry = RetryConfig{
+	Attempts:   3,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// backoff returns delay before the retry following attempt. Delay is
+// jittered over its upper half, so tasks failing at once don't retry
+// at once.
+func (sc *Scheduler) backoff(attempt int) time.Duration {
+	d := Retry.MaxBackoff
+	if attempt < 32 && Retry.Backoff<<uint(attempt) < d {
+		d = Retry.Backoff << uint(attempt)
+	}
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	sc.randMu.Lock()
+	defer sc.randMu.Unlock()
+	return time.Duration(half + sc.rand.Int63n(half+1))
+}
+
+// retry calls f till it succeeds, fails with error that is not transient,
+// runs out of attempts or ctx is done. Returns number of attempts made.
+func (sc *Scheduler) retry(ctx context.Context, what string, f func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= Retry.Attempts || model.ClassifyError(err) != model.ErrorClassTransient {
+			return attempt, err
+		}
+		wait := sc.backoff(attempt - 1)
+		glog.Infof("%s failed, retrying in %s: %v", what, wait, err)
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-sc.clock.After(wait):
+		}
+	}
+}
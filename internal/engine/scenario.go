@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// TaskSpec describes task to schedule
+	TaskSpec struct {
+		IntervalMin string `json:"int_min"`
+		IntervalMax string `json:"int_max"`
+		// Operation is name of the operation, destroy if empty
+		Operation string `json:"operation,omitempty"`
+		// Params of the operation, driver's defaults are used for missing ones
+		Params   map[string]string `json:"params,omitempty"`
+		Selector Selector          `json:"selector,omitempty"`
+		// MaxAffected limits number of entities task keeps affected at once
+		MaxAffected int `json:"max_affected,omitempty"`
+	}
+
+	// Scenario is a named set of tasks run together
+	Scenario struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description,omitempty"`
+		Tasks       []TaskSpec `json:"tasks"`
+	}
+
+	// scenarios keeps scenarios by name
+	scenarios struct {
+		mu     sync.Mutex
+		byName map[string]*Scenario
+	}
+)
+
+var (
+	// ErrScenarioNotFound is returned for names of unknown scenarios
+	ErrScenarioNotFound = errors.New("Scenario not found")
+	// ErrScenarioExists is returned when scenario with the name is already added
+	ErrScenarioExists = errors.New("Scenario already exists")
+)
+
+var scenarioNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// operation returns operation of the task
+func (ts *TaskSpec) operation() (model.Operation, error) {
+	op := model.Operation{Type: model.OperationTypeDestroy, Params: ts.Params}
+	if ts.Operation != "" {
+		var err error
+		if op.Type, err = model.ParseOperationType(ts.Operation); err != nil {
+			return op, err
+		}
+	}
+	return op, nil
+}
+
+// taskFromSpec checks spec and returns task described by it
+func (sc *Scheduler) taskFromSpec(spec *TaskSpec) (*task, error) {
+	op, err := spec.operation()
+	if err != nil {
+		return nil, err
+	}
+	return sc.newTask(spec.IntervalMin, spec.IntervalMax, op, spec.Selector, spec.MaxAffected)
+}
+
+// AddTask schedules task described by spec, returning its state
+func (sc *Scheduler) AddTask(spec TaskSpec) (TaskStatus, error) {
+	task, err := sc.taskFromSpec(&spec)
+	if err != nil {
+		return TaskStatus{}, err
+	}
+	return sc.Task(sc.addTask(task))
+}
+
+// RunScenario replaces scheduled tasks with tasks of the scenario and
+// starts them. Tasks are checked first, nothing is changed if any is bad.
+func (sc *Scheduler) RunScenario(scenario *Scenario) ([]TaskStatus, error) {
+	tasks := make([]*task, 0, len(scenario.Tasks))
+	for i := range scenario.Tasks {
+		task, err := sc.taskFromSpec(&scenario.Tasks[i])
+		if err != nil {
+			return nil, fmt.Errorf("Task %d: %v", i, err)
+		}
+		tasks = append(tasks, task)
+	}
+	sc.ClearTasks()
+	for _, task := range tasks {
+		sc.addTask(task)
+	}
+	if err := sc.StartTasks(); err != nil {
+		return nil, err
+	}
+	return sc.Tasks(), nil
+}
+
+// validateScenario checks scenario's name and tasks
+func (sc *Scheduler) validateScenario(scenario *Scenario) error {
+	if !scenarioNameRe.MatchString(scenario.Name) {
+		return fmt.Errorf("Bad scenario name %q, should be letters, digits, '_', '.' or '-'", scenario.Name)
+	}
+	if len(scenario.Tasks) == 0 {
+		return fmt.Errorf("Scenario %s has no tasks", scenario.Name)
+	}
+	for i := range scenario.Tasks {
+		if _, err := sc.taskFromSpec(&scenario.Tasks[i]); err != nil {
+			return fmt.Errorf("Task %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// LoadScenarios reads scenarios from JSON file holding array of them
+func LoadScenarios(path string) ([]Scenario, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenarios := make([]Scenario, 0)
+	if err := json.Unmarshal(b, &scenarios); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return scenarios, nil
+}
+
+// AddScenarios checks scenarios and adds them to the server, replacing
+// ones with the same names. Nothing is added if any of them is bad.
+func (srv *Server) AddScenarios(scenarios []Scenario) error {
+	names := make(map[string]bool, len(scenarios))
+	for i := range scenarios {
+		if err := srv.scheduler.validateScenario(&scenarios[i]); err != nil {
+			return fmt.Errorf("Scenario %d: %v", i, err)
+		}
+		if names[scenarios[i].Name] {
+			return fmt.Errorf("Scenario %s is listed twice", scenarios[i].Name)
+		}
+		names[scenarios[i].Name] = true
+	}
+	for i := range scenarios {
+		srv.scenarios.put(&scenarios[i], true)
+	}
+	return nil
+}
+
+func newScenarios() *scenarios {
+	return &scenarios{byName: make(map[string]*Scenario)}
+}
+
+// list returns scenarios sorted by name
+func (ss *scenarios) list() []*Scenario {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	res := make([]*Scenario, 0, len(ss.byName))
+	for _, s := range ss.byName {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func (ss *scenarios) get(name string) (*Scenario, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, has := ss.byName[name]
+	if !has {
+		return nil, ErrScenarioNotFound
+	}
+	return s, nil
+}
+
+// put adds scenario, replacing one with the same name if replace is true.
+// Returns true if scenario was added, not replaced.
+func (ss *scenarios) put(scenario *Scenario, replace bool) (bool, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	_, has := ss.byName[scenario.Name]
+	if has && !replace {
+		return false, ErrScenarioExists
+	}
+	ss.byName[scenario.Name] = scenario
+	return !has, nil
+}
+
+func (ss *scenarios) remove(name string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, has := ss.byName[name]; !has {
+		return ErrScenarioNotFound
+	}
+	delete(ss.byName, name)
+	return nil
+}
@@ -2,8 +2,11 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -16,75 +19,215 @@ type (
 		max time.Duration
 	}
 
-	filter struct {
-		key   string
-		value string
-	}
-
 	task struct {
+		// id of the task, never reused, so undos and
+		// events refer to the task after it is removed
+		id        int
 		interval  interval
-		operation model.OperationType
-		filter    filter
+		operation model.Operation
+		selector  Selector
 		running   bool
+		// maxAffected is maximum number of entities task keeps
+		// affected at once, unlimited if zero
+		maxAffected int
+		// health of the task, guarded by scheduler's mu
+		health taskHealth
+		// cancel stops task's loop, nil if it is not running
+		cancel context.CancelFunc
+	}
+
+	// taskHealth tells if task's runs fail because of the playground.
+	// Task is degraded if its last run failed to list entities or its
+	// operation failed with transient error after all the retries.
+	taskHealth struct {
+		degraded bool
+		// failures is number of consecutive degraded runs
+		failures      int
+		lastError     string
+		lastErrorTime time.Time
 	}
 
-	// Scheduler executes tasks toward playground
+	// TaskStatus is state of the task reported by the API
+	TaskStatus struct {
+		ID            int        `json:"id"`
+		Operation     string     `json:"operation"`
+		Selector      string     `json:"selector"`
+		IntervalMin   string     `json:"int_min"`
+		IntervalMax   string     `json:"int_max"`
+		MaxAffected   int        `json:"max_affected,omitempty"`
+		Running       bool       `json:"running"`
+		Degraded      bool       `json:"degraded"`
+		Failures      int        `json:"failures,omitempty"`
+		LastError     string     `json:"last_error,omitempty"`
+		LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	}
+
+	// affectedEntities are entities affected by the task's run and
+	// not recovered yet, by id. Each run of the task has its own,
+	// owned by its loop, so loop that is stopped but still finishing
+	// operation doesn't race with the one started after it.
+	affectedEntities map[string]*affectedEntity
+
+	affectedEntity struct {
+		name      string
+		operation model.Operation
+		since     time.Time
+	}
+
+	// Scheduler executes tasks toward playground, usually
+	// ChaosEngine combining several named playgrounds
 	Scheduler struct {
 		playground model.Playground
+		clock      model.Clock
+		randMu     sync.Mutex
+		rand       *rand.Rand
+		journal    *Journal
 		running    bool
 		context    context.Context
 		cancel     context.CancelFunc
-		tasks      []task
+		tasks      []*task
+		lastTaskID int
+		// undos of the operations not reverted yet, oldest first
+		undos      []*pendingUndo
+		lastUndoID int
+		// simJournal is journal of the simulation being run,
+		// status changes go there instead of the journal
+		simJournal *Journal
+		// mu guards tasks list, tasks' health, undos,
+		// running state and simJournal
+		mu sync.Mutex
 	}
 )
 
-// NewScheduler creates a new Scheduler
+// ErrTaskNotFound is returned for ids of tasks that are not scheduled
+var ErrTaskNotFound = errors.New("Task not found")
+
+// NewScheduler creates a new Scheduler. Status changes observed
+// by the playground, if it can observe them, go to the journal.
 func NewScheduler(playground model.Playground) *Scheduler {
-	// p := make([]model.Playground, len(playgrounds))
-	// copy(p, playgrounds)
-	// return &Scheduler{playgrounds: p}
-	return &Scheduler{playground: playground}
+	sc := &Scheduler{
+		playground: playground,
+		clock:      model.RealClock,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		journal:    NewJournal(journalSize),
+	}
+	if notifier, ok := playground.(model.StatusNotifier); ok {
+		notifier.NotifyStatus(sc.recordStatus)
+	}
+	return sc
+}
+
+// SetClock sets clock used to schedule tasks, the real one by default
+func (sc *Scheduler) SetClock(clock model.Clock) {
+	sc.clock = clock
+}
+
+// Journal returns journal of the scheduler's events
+func (sc *Scheduler) Journal() *Journal {
+	return sc.journal
 }
 
-// AddPlayground adds a new playground
-// func (sc *Scheduler) AddPlayground(playground model.Playground) {
-// 	sc.playgrounds = append(sc.playgrounds, playground)
-// }
+// ScheduleTask schedules operation on the entities selected by selector,
+// done every interval randomly chosen between intervalFrom and intervalTo.
+// If maxAffected is not zero, operations that would make more than that
+// many entities affected at once are refused. Operation and its
+// parameters are checked against capabilities of the playground.
+// Task is started at once if scheduler is running.
+func (sc *Scheduler) ScheduleTask(intervalFrom, intervalTo string, operation model.Operation, selector Selector, maxAffected int) error {
+	task, err := sc.newTask(intervalFrom, intervalTo, operation, selector, maxAffected)
+	if err != nil {
+		return err
+	}
+	sc.addTask(task)
+	return nil
+}
 
-// ScheduleTask ...
-func (sc *Scheduler) ScheduleTask(intervalFrom, intervalTo string, operation model.OperationType, filterKey, filterValue string) error {
+// newTask checks parameters of the task and returns it, not scheduled yet
+func (sc *Scheduler) newTask(intervalFrom, intervalTo string, operation model.Operation, selector Selector, maxAffected int) (*task, error) {
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	if err := sc.validateOperation(operation, &selector); err != nil {
+		return nil, err
+	}
 	var interval interval
 	pd, err := time.ParseDuration(intervalFrom)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	interval.min = pd
 	pd, err = time.ParseDuration(intervalTo)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	interval.max = pd
-	task := task{
-		interval: interval,
-		filter: filter{
-			key:   filterKey,
-			value: filterValue,
-		},
-		operation: operation,
+	if interval.max < interval.min {
+		return nil, fmt.Errorf("Interval max %s is less than min %s", interval.max, interval.min)
+	}
+	if maxAffected < 0 {
+		return nil, fmt.Errorf("Bad limit of affected entities %d", maxAffected)
 	}
+	return &task{
+		interval:    interval,
+		selector:    selector,
+		operation:   operation,
+		maxAffected: maxAffected,
+	}, nil
+}
+
+// addTask gives task an id and adds it to the list,
+// starting it if scheduler is running
+func (sc *Scheduler) addTask(task *task) int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	task.id = sc.lastTaskID
+	sc.lastTaskID++
 	sc.tasks = append(sc.tasks, task)
-	return nil
+	if sc.running {
+		sc.startTask(task)
+	}
+	return task.id
+}
+
+// startTask starts task's loop, should be called with mu locked
+func (sc *Scheduler) startTask(task *task) {
+	ctx, cancel := context.WithCancel(sc.context)
+	task.cancel = cancel
+	go sc.startTaskLoop(ctx, task)
+}
+
+// RemoveTask stops task and removes it from the list
+func (sc *Scheduler) RemoveTask(id int) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i, task := range sc.tasks {
+		if task.id != id {
+			continue
+		}
+		if task.cancel != nil {
+			task.cancel()
+			task.cancel = nil
+		}
+		sc.tasks = append(sc.tasks[:i], sc.tasks[i+1:]...)
+		glog.Infof("Removed task %d", id)
+		return nil
+	}
+	return ErrTaskNotFound
 }
 
 // ClearTasks stops all tasks and clears tasks list
 func (sc *Scheduler) ClearTasks() error {
 	sc.StopTasks()
-	sc.tasks = make([]task, 0)
+	sc.mu.Lock()
+	sc.tasks = make([]*task, 0)
+	sc.mu.Unlock()
 	return nil
 }
 
 // StartTasks starts scheduled tasks
 func (sc *Scheduler) StartTasks() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
 	if sc.running {
 		return fmt.Errorf("Already started")
 	}
@@ -92,7 +235,7 @@ func (sc *Scheduler) StartTasks() error {
 	sc.context = ctx
 	sc.cancel = cancel
 	for _, task := range sc.tasks {
-		go sc.startTaskLoop(ctx, &task)
+		sc.startTask(task)
 	}
 	sc.running = true
 	glog.Infof("Started %d tasks", len(sc.tasks))
@@ -100,55 +243,324 @@ func (sc *Scheduler) StartTasks() error {
 	return nil
 }
 
-func (sc *Scheduler) entitiesByLabel(key, value string) ([]model.Entity, error) {
+// entitiesBySelector returns entities selected for the operation,
+// using playground's query if it supports queries. Vms and tasks are
+// only selected if selector's type says so, so selectors by labels
+// keep targeting containers that run on them or run them.
+func (sc *Scheduler) entitiesBySelector(selector *Selector, operation model.OperationType) ([]model.Entity, error) {
 	res := make([]model.Entity, 0)
-	entities, err := sc.playground.Entities()
+	var entities []model.Entity
+	var err error
+	if querier, ok := sc.playground.(model.Querier); ok {
+		entities, err = querier.Query(selector.query(operation))
+	} else {
+		entities, err = sc.playground.Entities()
+	}
 	if err != nil {
 		return nil, err
 	}
-	for _, e := range entities {
-		labels := e.Labels()
-		if labels[key] == value {
+	for _, e := range selector.expand(entities) {
+		if selector.Type == "" && (e.Type() == model.EntityTypeVM || e.Type() == model.EntityTypeTask) {
+			continue
+		}
+		if selector.Match(e) {
 			res = append(res, e)
 		}
 	}
 	return res, nil
 }
 
+// Tree returns all the entities of the playground as a tree
+func (sc *Scheduler) Tree() ([]*TreeNode, error) {
+	entities, err := sc.playground.Entities()
+	if err != nil {
+		return nil, err
+	}
+	return buildTree(entities), nil
+}
+
 func (sc *Scheduler) startTaskLoop(ctx context.Context, task *task) {
+	affected := make(affectedEntities)
 	for {
-		toWait := task.interval.min + time.Duration(rand.Int63n(int64(task.interval.max-task.interval.min)))
-		glog.Infof("Wating %s", toWait)
-		time.Sleep(toWait)
+		toWait := sc.nextWait(task)
+		glog.Infof("Waiting %s", toWait)
 		select {
 		case <-ctx.Done():
 			return
-		default:
+		case <-sc.clock.After(toWait):
 		}
-		glog.Infof("Finding entities with label %s:%s", task.filter.key, task.filter.value)
-		entities, err := sc.entitiesByLabel(task.filter.key, task.filter.value)
-		if err != nil {
-			glog.Infof("Can't get entities: %v", err)
+		select {
+		case <-ctx.Done():
 			return
+		default:
+		}
+		// errors are journaled and make task degraded,
+		// task keeps running till it is stopped
+		sc.runTask(ctx, task, affected)
+	}
+}
+
+// nextWait returns random interval before task's next run
+func (sc *Scheduler) nextWait(task *task) time.Duration {
+	spread := int64(task.interval.max - task.interval.min)
+	if spread <= 0 {
+		return task.interval.min
+	}
+	sc.randMu.Lock()
+	defer sc.randMu.Unlock()
+	return task.interval.min + time.Duration(sc.rand.Int63n(spread))
+}
+
+func (sc *Scheduler) randIntn(n int) int {
+	sc.randMu.Lock()
+	defer sc.randMu.Unlock()
+	return sc.rand.Intn(n)
+}
+
+// runTask does task's operation on one of the selected entities,
+// if it doesn't exceed task's limit of affected entities. Operation is
+// cancelled when ctx is done or when it takes longer than its timeout.
+func (sc *Scheduler) runTask(ctx context.Context, task *task, affected affectedEntities) error {
+	glog.Infof("Finding entities with selector %s", task.selector)
+	var entities []model.Entity
+	attempts, err := sc.retry(ctx, "Listing entities", func() error {
+		var err error
+		entities, err = sc.entitiesBySelector(&task.selector, task.operation.Type)
+		if err == nil {
+			entities = sc.supporting(entities, task.operation.Type)
+		}
+		return err
+	})
+	if err != nil {
+		glog.Infof("Can't get entities after %d attempts: %v", attempts, err)
+		sc.record(task, EventError, nil, fmt.Sprintf("Can't get entities after %d attempts: %v", attempts, err))
+		sc.setHealth(task, err)
+		return err
+	}
+	glog.Infof("Found %d entities", len(entities))
+	sc.checkRecoveries(ctx, task, affected, entities)
+	candidates := make([]model.Entity, 0, len(entities))
+	for _, e := range entities {
+		if _, has := affected[e.ID()]; !has {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		glog.Infof("No entities found")
+		sc.setHealth(task, nil)
+		return nil
+	}
+	ent := candidates[sc.randIntn(len(candidates))]
+	if task.maxAffected > 0 && len(affected) >= task.maxAffected {
+		glog.Infof("Not doing %s on entity %s, %d entities are affected already", task.operation, ent.Name(), len(affected))
+		sc.record(task, EventRefusal, ent, fmt.Sprintf("%d entities are affected already", len(affected)))
+		sc.setHealth(task, nil)
+		return nil
+	}
+	glog.Infof("Doing %s on entity %s", task.operation, ent.Name())
+	var undo model.Undo
+	attempts, err = sc.retry(ctx, fmt.Sprintf("Doing %s on entity %s", task.operation, ent.Name()), func() error {
+		opCtx, cancel := context.WithTimeout(ctx, operationTimeout(task.operation.Type))
+		defer cancel()
+		var err error
+		undo, err = doReversible(opCtx, ent, task.operation)
+		return err
+	})
+	if err != nil {
+		class := model.ClassifyError(err)
+		glog.Infof("Error doing %s on entity %s after %d attempts: %v", task.operation, ent.Name(), attempts, err)
+		sc.record(task, EventError, ent, fmt.Sprintf("%s error after %d attempts: %v", class, attempts, err))
+		if class == model.ErrorClassTransient {
+			sc.setHealth(task, err)
+		} else {
+			// entity's fault, not playground's
+			sc.setHealth(task, nil)
 		}
-		glog.Infof("Found %d entities", len(entities))
-		if len(entities) == 0 {
-			glog.Infof("No entities found")
+		return nil
+	}
+	sc.setHealth(task, nil)
+	sc.record(task, EventOperation, ent, "")
+	if undo != nil {
+		sc.addUndo(task, ent, undo)
+	}
+	affected[ent.ID()] = &affectedEntity{
+		name:      ent.Name(),
+		operation: task.operation,
+		since:     sc.clock.Now(),
+	}
+	return nil
+}
+
+// checkRecoveries forgets affected entities that are working
+// again or not selected anymore, e.g. destroyed and replaced
+func (sc *Scheduler) checkRecoveries(ctx context.Context, task *task, affected affectedEntities, entities []model.Entity) {
+	if len(affected) == 0 {
+		return
+	}
+	byID := make(map[string]model.Entity, len(entities))
+	for _, e := range entities {
+		byID[e.ID()] = e
+	}
+	// ids are sorted, so simulations journal recoveries in the same order
+	ids := make([]string, 0, len(affected))
+	for id := range affected {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ae := affected[id]
+		msg := ""
+		if e, has := byID[id]; !has {
+			msg = "gone"
+		} else if status, err := sc.status(ctx, e); err == nil && status == model.StatusTypeWorking {
+			msg = "working"
+		} else if err != nil && model.ClassifyError(err) == model.ErrorClassGone {
+			msg = "gone"
+		} else {
 			continue
 		}
-		ent := entities[rand.Intn(len(entities))]
-		glog.Infof("Killing entity %s", ent.Name())
-		err = ent.Do(task.operation)
-		if err != nil {
-			glog.Infof("Error killing entity %s: %v", ent.Name(), err)
+		delete(affected, id)
+		sc.forgetUndos(task, id)
+		glog.Infof("Entity %s recovered from %s: %s", ae.name, ae.operation, msg)
+		sc.journal.Add(Event{
+			Time:      sc.clock.Now(),
+			Type:      EventRecovery,
+			Task:      task.id,
+			EntityID:  id,
+			Entity:    ae.name,
+			Operation: ae.operation.String(),
+			Message:   fmt.Sprintf("%s after %s", msg, sc.clock.Now().Sub(ae.since).Round(time.Second)),
+		})
+	}
+}
+
+func (sc *Scheduler) status(ctx context.Context, e model.Entity) (model.StatusType, error) {
+	ctx, cancel := context.WithTimeout(ctx, StatusTimeout)
+	defer cancel()
+	return e.Status(ctx)
+}
+
+// setHealth makes task degraded if err is not nil, healthy otherwise
+func (sc *Scheduler) setHealth(task *task, err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	h := &task.health
+	if err == nil {
+		if h.degraded {
+			glog.Infof("Task %d is healthy again", task.id)
+		}
+		h.degraded = false
+		h.failures = 0
+		return
+	}
+	h.degraded = true
+	h.failures++
+	h.lastError = err.Error()
+	h.lastErrorTime = sc.clock.Now()
+}
+
+// Tasks returns state of the scheduled tasks
+func (sc *Scheduler) Tasks() []TaskStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	res := make([]TaskStatus, 0, len(sc.tasks))
+	for _, task := range sc.tasks {
+		res = append(res, task.status())
+	}
+	return res
+}
+
+// Task returns state of the task
+func (sc *Scheduler) Task(id int) (TaskStatus, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, task := range sc.tasks {
+		if task.id == id {
+			return task.status(), nil
 		}
 	}
+	return TaskStatus{}, ErrTaskNotFound
+}
+
+// status returns state of the task, should be called with scheduler's mu locked
+func (task *task) status() TaskStatus {
+	var lastErrorTime *time.Time
+	if !task.health.lastErrorTime.IsZero() {
+		t := task.health.lastErrorTime
+		lastErrorTime = &t
+	}
+	return TaskStatus{
+		ID:            task.id,
+		Operation:     task.operation.String(),
+		Selector:      task.selector.String(),
+		IntervalMin:   task.interval.min.String(),
+		IntervalMax:   task.interval.max.String(),
+		MaxAffected:   task.maxAffected,
+		Running:       task.cancel != nil,
+		Degraded:      task.health.degraded,
+		Failures:      task.health.failures,
+		LastError:     task.health.lastError,
+		LastErrorTime: lastErrorTime,
+	}
+}
+
+func (sc *Scheduler) recordStatus(change model.StatusChange) {
+	journal := sc.journal
+	sc.mu.Lock()
+	if sc.simJournal != nil {
+		journal = sc.simJournal
+	}
+	sc.mu.Unlock()
+	journal.Add(Event{
+		Time:     change.Time,
+		Type:     EventStatus,
+		Task:     -1,
+		EntityID: change.EntityID,
+		Entity:   change.Name,
+		Message:  change.Status.String() + ", " + change.Reason,
+	})
+}
+
+func (sc *Scheduler) record(task *task, etype EventType, e model.Entity, msg string) {
+	ev := Event{
+		Time:      sc.clock.Now(),
+		Type:      etype,
+		Task:      task.id,
+		Operation: task.operation.String(),
+		Message:   msg,
+	}
+	if e != nil {
+		ev.EntityID = e.ID()
+		ev.Entity = e.Name()
+	}
+	sc.journal.Add(ev)
+}
+
+// Running returns true if tasks are started
+func (sc *Scheduler) Running() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.running
+}
+
+// Health returns health of the nodes' APIs playground works
+// through, empty if it doesn't track it
+func (sc *Scheduler) Health() []model.NodeHealth {
+	if reporter, ok := sc.playground.(model.HealthReporter); ok {
+		return reporter.Health()
+	}
+	return []model.NodeHealth{}
 }
 
 // StopTasks stops the scheduler
 func (sc *Scheduler) StopTasks() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
 	if sc.cancel != nil {
 		sc.cancel()
+		for _, task := range sc.tasks {
+			task.cancel = nil
+		}
 		sc.running = false
 		sc.cancel = nil
 		sc.context = nil
@@ -0,0 +1,475 @@
+package engine
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/fake"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// testStart is start of the simulated time
+var testStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testEntities are two vms, three web containers on the first one,
+// one of them stopped, and db container on the second one
+func testEntities() []fake.EntityConfig {
+	return []fake.EntityConfig{
+		{ID: "n1", Name: "node1", Type: "vm", Labels: map[string]string{"zone": "a"}},
+		{ID: "n2", Name: "node2", Type: "vm", Labels: map[string]string{"zone": "b"}},
+		{ID: "c1", Name: "web-1", Type: "container", Parent: "n1", Labels: map[string]string{"app": "web"}},
+		{ID: "c2", Name: "web-2", Type: "container", Parent: "n1", Labels: map[string]string{"app": "web"}},
+		{ID: "c3", Name: "web-3", Type: "container", Parent: "n1", Labels: map[string]string{"app": "web"}, Status: "stopped"},
+		{ID: "c4", Name: "db-1", Type: "container", Parent: "n2", Labels: map[string]string{"app": "db"}},
+	}
+}
+
+// newTestScheduler returns scheduler of engine with fake playground
+// named fake of the entities, both using simulated clock
+func newTestScheduler(t *testing.T, configs []fake.EntityConfig) (*Scheduler, *fake.FakePlayground, *SimClock) {
+	t.Helper()
+	fp, err := fake.NewFakePlayground(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce := NewChaosEngine()
+	if err := ce.AddPlayground("fake", fp); err != nil {
+		t.Fatal(err)
+	}
+	clock := NewSimClock(testStart)
+	fp.SetClock(clock)
+	sc := NewScheduler(ce)
+	sc.SetClock(clock)
+	return sc, fp, clock
+}
+
+// eventTypes returns types of the events, leaving out status changes
+func eventTypes(events []Event) []EventType {
+	res := make([]EventType, 0, len(events))
+	for _, e := range events {
+		if e.Type != EventStatus {
+			res = append(res, e.Type)
+		}
+	}
+	return res
+}
+
+// runTasks runs tasks like simulation does, but on the scheduler
+// itself, so its undos and health can be checked
+func runTasks(sc *Scheduler, clock *SimClock, duration time.Duration) []Event {
+	sc.simulate(clock, duration)
+	return sc.Journal().Events()
+}
+
+func countEvents(events []Event, etype EventType) int {
+	n := 0
+	for _, e := range events {
+		if e.Type == etype {
+			n++
+		}
+	}
+	return n
+}
+
+func TestScheduleTaskValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, to    string
+		op          model.Operation
+		selector    Selector
+		maxAffected int
+		wantErr     bool
+	}{
+		{name: "ok", from: "1m", to: "2m", op: model.NewOperation(model.OperationTypePause)},
+		{name: "bad interval", from: "1x", to: "2m", op: model.NewOperation(model.OperationTypePause), wantErr: true},
+		{name: "max less than min", from: "2m", to: "1m", op: model.NewOperation(model.OperationTypePause), wantErr: true},
+		{name: "negative limit", from: "1m", to: "1m", op: model.NewOperation(model.OperationTypePause), maxAffected: -1, wantErr: true},
+		{name: "bad state", from: "1m", to: "1m", op: model.NewOperation(model.OperationTypePause), selector: Selector{State: "paused"}, wantErr: true},
+		{name: "unknown playground", from: "1m", to: "1m", op: model.NewOperation(model.OperationTypePause), selector: Selector{Playground: "other"}, wantErr: true},
+		{
+			name:     "bad param",
+			from:     "1m",
+			to:       "1m",
+			op:       model.Operation{Type: model.OperationTypePause, Params: map[string]string{"duration": "soon"}},
+			wantErr:  true,
+			selector: Selector{Type: "container"},
+		},
+		{name: "negative duration", from: "1m", to: "1m", op: model.Operation{Type: model.OperationTypePause, Params: map[string]string{"duration": "-5s"}}, wantErr: true},
+		{name: "zero memory", from: "1m", to: "1m", op: model.Operation{Type: model.OperationTypeSlowdown, Params: map[string]string{"memory_mb": "0"}}, wantErr: true},
+		{name: "negative memory", from: "1m", to: "1m", op: model.Operation{Type: model.OperationTypeSlowdown, Params: map[string]string{"memory_mb": "-1"}}, wantErr: true},
+		{name: "negative timeout", from: "1m", to: "1m", op: model.Operation{Type: model.OperationTypeStop, Params: map[string]string{"timeout": "-1s"}}, wantErr: true},
+		{name: "zero timeout", from: "1m", to: "1m", op: model.Operation{Type: model.OperationTypeStop, Params: map[string]string{"timeout": "0s"}}},
+		{name: "negative offset", from: "1m", to: "1m", op: model.Operation{Type: model.OperationTypeSkewClock, Params: map[string]string{"offset": "-1h"}}},
+	}
+	for _, tt := range tests {
+		sc, _, _ := newTestScheduler(t, testEntities())
+		err := sc.ScheduleTask(tt.from, tt.to, tt.op, tt.selector, tt.maxAffected)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ScheduleTask error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// TestMaxAffected checks that operations making more entities
+// affected than task's limit are refused
+func TestMaxAffected(t *testing.T) {
+	tests := []struct {
+		maxAffected    int
+		wantOperations int
+		wantRefusals   int
+	}{
+		// three web containers, so the fourth run finds nothing to affect
+		{maxAffected: 0, wantOperations: 3, wantRefusals: 0},
+		{maxAffected: 1, wantOperations: 1, wantRefusals: 3},
+		{maxAffected: 2, wantOperations: 2, wantRefusals: 2},
+		{maxAffected: 5, wantOperations: 3, wantRefusals: 0},
+	}
+	for _, tt := range tests {
+		sc, _, clock := newTestScheduler(t, testEntities())
+		selector := Selector{Labels: map[string]string{"app": "web"}}
+		if err := sc.ScheduleTask("1m", "1m", model.NewOperation(model.OperationTypePause), selector, tt.maxAffected); err != nil {
+			t.Fatal(err)
+		}
+		events := runTasks(sc, clock, 4*time.Minute+30*time.Second)
+		if n := countEvents(events, EventOperation); n != tt.wantOperations {
+			t.Errorf("max_affected %d: %d operations, want %d", tt.maxAffected, n, tt.wantOperations)
+		}
+		if n := countEvents(events, EventRefusal); n != tt.wantRefusals {
+			t.Errorf("max_affected %d: %d refusals, want %d", tt.maxAffected, n, tt.wantRefusals)
+		}
+		if n := len(sc.Undos()); n != tt.wantOperations {
+			t.Errorf("max_affected %d: %d undos, want %d", tt.maxAffected, n, tt.wantOperations)
+		}
+	}
+}
+
+// TestSupportedEntities checks that tasks by labels leave out swarm
+// tasks and entities that don't support their operation
+func TestSupportedEntities(t *testing.T) {
+	configs := append(testEntities(),
+		fake.EntityConfig{ID: "t1", Name: "web.1", Type: "task", Parent: "n1", Labels: map[string]string{"app": "web"}},
+		fake.EntityConfig{ID: "w1", Name: "web", Type: "workload", Labels: map[string]string{"app": "web"}, Operations: []string{"scale_down"}},
+	)
+	tests := []struct {
+		name     string
+		op       model.OperationType
+		selector Selector
+		want     []string
+	}{
+		{name: "pause", op: model.OperationTypePause, selector: Selector{Labels: map[string]string{"app": "web"}}, want: []string{"fake:web-1", "fake:web-2", "fake:web-3"}},
+		{name: "destroy", op: model.OperationTypeDestroy, selector: Selector{Labels: map[string]string{"app": "web"}}, want: []string{"fake:web-1", "fake:web-2"}},
+		{name: "tasks by type", op: model.OperationTypePause, selector: Selector{Type: "task"}, want: []string{"fake:web.1"}},
+	}
+	for _, tt := range tests {
+		sc, _, clock := newTestScheduler(t, configs)
+		if err := sc.ScheduleTask("1m", "1m", model.NewOperation(tt.op), tt.selector, 0); err != nil {
+			t.Fatal(err)
+		}
+		events, err := sc.Simulate(clock, 4*time.Minute+30*time.Second, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0)
+		for _, e := range events {
+			switch e.Type {
+			case EventOperation:
+				got = append(got, e.Entity)
+			case EventError:
+				t.Errorf("%s: error %s", tt.name, e.Message)
+			}
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: operations on %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRecovery checks that entities working again or gone are
+// forgotten, so they can be affected again and limit isn't hit
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name         string
+		op           model.Operation
+		recoverAfter string
+		want         []EventType
+		// wantMessage is prefix of the recovery message
+		wantMessage string
+		wantUndos   int
+	}{
+		{
+			name:         "working",
+			op:           model.NewOperation(model.OperationTypePause),
+			recoverAfter: "5m",
+			want:         []EventType{EventOperation, EventRecovery, EventOperation},
+			wantMessage:  "working after 5m0s",
+			wantUndos:    1,
+		},
+		{
+			name:         "duration param",
+			op:           model.Operation{Type: model.OperationTypePause, Params: map[string]string{"duration": "2m"}},
+			recoverAfter: "5m",
+			want: []EventType{
+				EventOperation, EventRecovery, EventOperation, EventRecovery, EventOperation,
+				EventRecovery, EventOperation, EventRecovery, EventOperation,
+			},
+			wantMessage: "working after 2m0s",
+			wantUndos:   1,
+		},
+		{
+			name:        "gone",
+			op:          model.NewOperation(model.OperationTypeDestroy),
+			want:        []EventType{EventOperation, EventRecovery},
+			wantMessage: "gone",
+		},
+		{
+			name: "never",
+			op:   model.NewOperation(model.OperationTypePause),
+			want: []EventType{EventOperation},
+			// affected entity is not selected again
+			wantUndos: 1,
+		},
+	}
+	for _, tt := range tests {
+		configs := testEntities()
+		configs[2].RecoverAfter = tt.recoverAfter
+		sc, _, clock := newTestScheduler(t, configs)
+		if err := sc.ScheduleTask("1m", "1m", tt.op, Selector{Name: "web-1"}, 1); err != nil {
+			t.Fatal(err)
+		}
+		events := runTasks(sc, clock, 10*time.Minute+30*time.Second)
+		got := eventTypes(events)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: events %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: events %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+		for _, e := range events {
+			if e.Type == EventRecovery && !strings.HasPrefix(e.Message, tt.wantMessage) {
+				t.Errorf("%s: recovery message %q, want %q", tt.name, e.Message, tt.wantMessage)
+			}
+		}
+		if n := len(sc.Undos()); n != tt.wantUndos {
+			t.Errorf("%s: %d undos, want %d", tt.name, n, tt.wantUndos)
+		}
+	}
+}
+
+// TestRetry checks that only transient errors are retried and
+// make the task degraded
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          string
+		wantAttempts int
+		wantDegraded bool
+		wantClass    model.ErrorClass
+	}{
+		{name: "transient", err: "transient: busy", wantAttempts: Retry.Attempts, wantDegraded: true, wantClass: model.ErrorClassTransient},
+		{name: "gone", err: "gone: no such container", wantAttempts: 1, wantClass: model.ErrorClassGone},
+		{name: "permanent", err: "broken", wantAttempts: 1, wantClass: model.ErrorClassPermanent},
+	}
+	for _, tt := range tests {
+		configs := testEntities()
+		configs[2].Errors = map[string]string{"pause": tt.err}
+		sc, fp, clock := newTestScheduler(t, configs)
+		if err := sc.ScheduleTask("1m", "1m", model.NewOperation(model.OperationTypePause), Selector{Name: "web-1"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		events := runTasks(sc, clock, time.Minute+30*time.Second)
+		if n := len(fp.Calls()); n != tt.wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, n, tt.wantAttempts)
+		}
+		if n := countEvents(events, EventError); n != 1 {
+			t.Errorf("%s: %d errors journaled, want 1", tt.name, n)
+		}
+		for _, e := range events {
+			if e.Type == EventError && !strings.HasPrefix(e.Message, tt.wantClass.String()) {
+				t.Errorf("%s: error message %q, want %s error", tt.name, e.Message, tt.wantClass)
+			}
+		}
+		task := sc.Tasks()[0]
+		if task.Degraded != tt.wantDegraded {
+			t.Errorf("%s: task degraded %v, want %v", tt.name, task.Degraded, tt.wantDegraded)
+		}
+	}
+}
+
+// TestDegraded checks that task failing to list entities is degraded
+// till its run succeeds
+func TestDegraded(t *testing.T) {
+	sc, fp, clock := newTestScheduler(t, testEntities())
+	if err := sc.ScheduleTask("1m", "1m", model.NewOperation(model.OperationTypePause), Selector{Name: "web-*"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	fp.SetEntitiesError(model.TransientError(errors.New("api is down")))
+	runTasks(sc, clock, 3*time.Minute+30*time.Second)
+	task := sc.Tasks()[0]
+	if !task.Degraded || task.Failures != 3 || !strings.Contains(task.LastError, "api is down") || task.LastErrorTime == nil {
+		t.Errorf("Task after failed runs: %+v", task)
+	}
+	fp.SetEntitiesError(nil)
+	runTasks(sc, clock, time.Minute+30*time.Second)
+	task = sc.Tasks()[0]
+	if task.Degraded || task.Failures != 0 {
+		t.Errorf("Task after successful run: %+v", task)
+	}
+}
+
+// TestSimulateIsolated checks that simulation leaves no undos,
+// health or events in the scheduler it is run by
+func TestSimulateIsolated(t *testing.T) {
+	configs := testEntities()
+	configs[3].Errors = map[string]string{"pause": "transient: busy"}
+	sc, _, clock := newTestScheduler(t, configs)
+	for _, name := range []string{"web-1", "web-2"} {
+		if err := sc.ScheduleTask("1m", "1m", model.NewOperation(model.OperationTypePause), Selector{Name: name}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := sc.Simulate(clock, 3*time.Minute+30*time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countEvents(events, EventOperation) == 0 || countEvents(events, EventError) == 0 {
+		t.Fatalf("Simulation had no operations or errors: %v", eventTypes(events))
+	}
+	if n := len(sc.Undos()); n != 0 {
+		t.Errorf("%d undos left by simulation", n)
+	}
+	for _, task := range sc.Tasks() {
+		if task.Degraded || task.Failures != 0 {
+			t.Errorf("Task after simulation: %+v", task)
+		}
+	}
+	for _, e := range sc.Journal().Events() {
+		if e.Type != EventStatus {
+			t.Errorf("Event %v left in the journal by simulation", e)
+		}
+	}
+}
+
+// TestSimulateDeterministic checks that simulations with the same seed
+// give the same timeline
+func TestSimulateDeterministic(t *testing.T) {
+	timeline := func() []string {
+		configs := testEntities()
+		for i := range configs {
+			configs[i].RecoverAfter = "3m"
+		}
+		sc, _, clock := newTestScheduler(t, configs)
+		if err := sc.ScheduleTask("30s", "2m", model.NewOperation(model.OperationTypePause), Selector{Type: "container"}, 2); err != nil {
+			t.Fatal(err)
+		}
+		events, err := sc.Simulate(clock, time.Hour, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make([]string, 0, len(events))
+		for _, e := range events {
+			res = append(res, e.String())
+		}
+		return res
+	}
+	first, second := timeline(), timeline()
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Errorf("Timelines differ:\n%s\n\n%s", strings.Join(first, "\n"), strings.Join(second, "\n"))
+	}
+	if len(first) == 0 {
+		t.Error("Empty timeline")
+	}
+}
+
+func TestTaskIDs(t *testing.T) {
+	sc, _, _ := newTestScheduler(t, testEntities())
+	op := model.NewOperation(model.OperationTypePause)
+	for i := 0; i < 3; i++ {
+		if err := sc.ScheduleTask("1m", "1m", op, Selector{}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sc.RemoveTask(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.RemoveTask(1); err != ErrTaskNotFound {
+		t.Errorf("Removing removed task: %v, want %v", err, ErrTaskNotFound)
+	}
+	sc.ClearTasks()
+	if err := sc.ScheduleTask("1m", "1m", op, Selector{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	tasks := sc.Tasks()
+	if len(tasks) != 1 || tasks[0].ID != 3 {
+		t.Errorf("Tasks after clear %+v, want one with id 3", tasks)
+	}
+}
+
+// TestStartStop starts and stops tasks running on the real clock,
+// to be run with -race
+func TestStartStop(t *testing.T) {
+	configs := testEntities()
+	for i := range configs {
+		configs[i].RecoverAfter = "1ms"
+	}
+	fp, err := fake.NewFakePlayground(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := NewScheduler(fp)
+	op := model.NewOperation(model.OperationTypePause)
+	for i := 0; i < 2; i++ {
+		if err := sc.ScheduleTask("1ms", "2ms", op, Selector{Type: "container"}, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for round := 0; round < 3; round++ {
+		if err := sc.StartTasks(); err != nil {
+			t.Fatal(err)
+		}
+		if err := sc.StartTasks(); err == nil {
+			t.Error("Started tasks twice")
+		}
+		// task added while running is started at once
+		if err := sc.ScheduleTask("1ms", "1ms", op, Selector{Name: "web-*"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for countEvents(sc.Journal().Events(), EventOperation) < 10*(round+1) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		for _, task := range sc.Tasks() {
+			if !task.Running {
+				t.Errorf("Task %d is not running", task.ID)
+			}
+		}
+		if !sc.StopTasks() {
+			t.Error("StopTasks didn't stop running tasks")
+		}
+		if sc.StopTasks() {
+			t.Error("StopTasks stopped tasks twice")
+		}
+		sc.Tasks()
+		sc.Undos()
+	}
+	if n := countEvents(sc.Journal().Events(), EventOperation); n < 30 {
+		t.Errorf("Only %d operations done", n)
+	}
+	ids := make([]int, 0)
+	for _, task := range sc.Tasks() {
+		ids = append(ids, task.ID)
+	}
+	sort.Ints(ids)
+	for i := 1; i < len(ids); i++ {
+		if ids[i] == ids[i-1] {
+			t.Errorf("Task id %d is used twice", ids[i])
+		}
+	}
+}
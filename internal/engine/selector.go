@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// Selector selects entities by labels, type, name and ancestors.
+	// Empty fields match any entity.
+	Selector struct {
+		// Labels entity should have
+		Labels map[string]string `json:"labels,omitempty"`
+		// Type of the entity (container, process, vm, task, ...),
+		// vms are only selected if it is vm
+		Type string `json:"type,omitempty"`
+		// Name is a glob pattern matched against entity's name,
+		// either qualified by playground name or not
+		Name string `json:"name,omitempty"`
+		// Playground is name of the playground entity belongs to
+		Playground string `json:"playground,omitempty"`
+		// State of the entities: running or any. If empty, only
+		// running entities are destroyed, other operations select any.
+		State string `json:"state,omitempty"`
+		// Ancestors each of which should match one of entity's
+		// ancestors, so one can select, for example, containers
+		// of service X on node Y
+		Ancestors []Selector `json:"ancestors,omitempty"`
+	}
+)
+
+const (
+	stateRunning = "running"
+	stateAny     = "any"
+)
+
+// Validate checks that selector is well-formed
+func (s *Selector) Validate() error {
+	if s.State != "" && s.State != stateRunning && s.State != stateAny {
+		return fmt.Errorf("Bad state %q, should be running or any", s.State)
+	}
+	if s.Type != "" {
+		if _, err := model.ParseEntityType(s.Type); err != nil {
+			return err
+		}
+	}
+	if s.Name != "" {
+		if _, err := path.Match(s.Name, ""); err != nil {
+			return fmt.Errorf("Bad name pattern %q: %v", s.Name, err)
+		}
+	}
+	for i := range s.Ancestors {
+		if err := s.Ancestors[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns true if entity is selected by the selector
+func (s *Selector) Match(e model.Entity) bool {
+	if !s.matchSelf(e) {
+		return false
+	}
+	for i := range s.Ancestors {
+		found := false
+		for p := e.Parent(); p != nil; p = p.Parent() {
+			if s.Ancestors[i].Match(p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// query returns playground query selecting superset of the entities
+// selector selects for the operation
+func (s *Selector) query(operation model.OperationType) model.Query {
+	q := model.Query{
+		Labels:     s.Labels,
+		Playground: s.Playground,
+		Running:    s.State == stateRunning || (s.State == "" && operation == model.OperationTypeDestroy),
+	}
+	if s.Type == "" {
+		q.Name = s.Name
+	} else if et, _ := model.ParseEntityType(s.Type); et == model.EntityTypeProcess {
+		// processes may be found in the containers,
+		// name is process' own, not container's
+		q.Types = []model.EntityType{model.EntityTypeContainer, model.EntityTypeProcess}
+	} else {
+		q.Types = []model.EntityType{et}
+		q.Name = s.Name
+	}
+	return q
+}
+
+// expand adds to the entities processes of the containers
+// if selector selects processes. Processes are not listed by
+// the playgrounds because discovering them is expensive, so
+// only containers that can be their parents are looked into.
+func (s *Selector) expand(entities []model.Entity) []model.Entity {
+	if s.Type != model.EntityTypeProcess.String() {
+		return entities
+	}
+	res := make([]model.Entity, 0, len(entities))
+	parent := Selector{
+		Type:   model.EntityTypeContainer.String(),
+		Labels: s.Labels,
+	}
+	for _, e := range entities {
+		res = append(res, e)
+		if !parent.Match(e) || !s.ancestorsMayMatch(e) {
+			continue
+		}
+		for _, c := range e.Childs() {
+			if c.Type() == model.EntityTypeProcess {
+				res = append(res, c)
+			}
+		}
+	}
+	return res
+}
+
+// ancestorsMayMatch returns true if ancestor selectors match
+// entity itself or its ancestors
+func (s *Selector) ancestorsMayMatch(e model.Entity) bool {
+	for i := range s.Ancestors {
+		found := false
+		for p := e; p != nil; p = p.Parent() {
+			if s.Ancestors[i].Match(p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Selector) matchSelf(e model.Entity) bool {
+	if s.Type != "" && e.Type().String() != s.Type {
+		return false
+	}
+	pe, inPlayground := e.(*playgroundEntity)
+	if s.Playground != "" && (!inPlayground || pe.Playground() != s.Playground) {
+		return false
+	}
+	if s.Name != "" {
+		matched, _ := path.Match(s.Name, e.Name())
+		if !matched && inPlayground {
+			matched, _ = path.Match(s.Name, pe.LocalName())
+		}
+		if !matched {
+			return false
+		}
+	}
+	labels := e.Labels()
+	for k, v := range s.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	str := fmt.Sprintf("labels:%v", s.Labels)
+	if s.Type != "" {
+		str += " type:" + s.Type
+	}
+	if s.Name != "" {
+		str += " name:" + s.Name
+	}
+	if s.Playground != "" {
+		str += " playground:" + s.Playground
+	}
+	if s.State != "" {
+		str += " state:" + s.State
+	}
+	for _, a := range s.Ancestors {
+		str += " within(" + a.String() + ")"
+	}
+	return str
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// testEntity returns entity of the test scheduler with the local name
+func testEntity(t *testing.T, sc *Scheduler, name string) model.Entity {
+	t.Helper()
+	entities, err := sc.playground.Entities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entities {
+		if e.(*playgroundEntity).LocalName() == name {
+			return e
+		}
+	}
+	t.Fatalf("No entity %s", name)
+	return nil
+}
+
+func TestSelectorValidate(t *testing.T) {
+	tests := []struct {
+		selector Selector
+		wantErr  bool
+	}{
+		{selector: Selector{}},
+		{selector: Selector{State: "running", Type: "container", Name: "web-*"}},
+		{selector: Selector{State: "any"}},
+		{selector: Selector{State: "stopped"}, wantErr: true},
+		{selector: Selector{Type: "pod"}, wantErr: true},
+		{selector: Selector{Name: "web-["}, wantErr: true},
+		{selector: Selector{Ancestors: []Selector{{Type: "vm"}}}},
+		{selector: Selector{Ancestors: []Selector{{Type: "host"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.selector.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%s) error = %v, want error %v", tt.selector, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	sc, _, _ := newTestScheduler(t, testEntities())
+	tests := []struct {
+		selector Selector
+		entity   string
+		want     bool
+	}{
+		{selector: Selector{}, entity: "web-1", want: true},
+		{selector: Selector{Name: "web-*"}, entity: "web-1", want: true},
+		{selector: Selector{Name: "fake:web-*"}, entity: "web-1", want: true},
+		{selector: Selector{Name: "other:web-*"}, entity: "web-1", want: false},
+		{selector: Selector{Name: "db-*"}, entity: "web-1", want: false},
+		{selector: Selector{Playground: "fake"}, entity: "web-1", want: true},
+		{selector: Selector{Playground: "other"}, entity: "web-1", want: false},
+		{selector: Selector{Type: "container"}, entity: "web-1", want: true},
+		{selector: Selector{Type: "vm"}, entity: "web-1", want: false},
+		{selector: Selector{Labels: map[string]string{"app": "web"}}, entity: "web-1", want: true},
+		{selector: Selector{Labels: map[string]string{"app": "web", "tier": "front"}}, entity: "web-1", want: false},
+		{selector: Selector{Ancestors: []Selector{{Labels: map[string]string{"zone": "a"}}}}, entity: "web-1", want: true},
+		{selector: Selector{Ancestors: []Selector{{Labels: map[string]string{"zone": "a"}}}}, entity: "db-1", want: false},
+		{selector: Selector{Ancestors: []Selector{{Name: "node2"}}}, entity: "db-1", want: true},
+		{selector: Selector{Ancestors: []Selector{{Type: "vm"}, {Name: "node1"}}}, entity: "db-1", want: false},
+		// vm has no ancestors
+		{selector: Selector{Ancestors: []Selector{{}}}, entity: "node1", want: false},
+	}
+	for _, tt := range tests {
+		e := testEntity(t, sc, tt.entity)
+		if got := tt.selector.Match(e); got != tt.want {
+			t.Errorf("Selector %s matches %s: %v, want %v", tt.selector, tt.entity, got, tt.want)
+		}
+	}
+}
+
+// TestEntitiesBySelector checks what entities tasks select,
+// including state, which depends on the operation
+func TestEntitiesBySelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector Selector
+		op       model.OperationType
+		want     []string
+	}{
+		{
+			name:     "destroy running by default",
+			selector: Selector{Labels: map[string]string{"app": "web"}},
+			op:       model.OperationTypeDestroy,
+			want:     []string{"fake:web-1", "fake:web-2"},
+		},
+		{
+			name:     "destroy any",
+			selector: Selector{Labels: map[string]string{"app": "web"}, State: "any"},
+			op:       model.OperationTypeDestroy,
+			want:     []string{"fake:web-1", "fake:web-2", "fake:web-3"},
+		},
+		{
+			name:     "pause any by default",
+			selector: Selector{Labels: map[string]string{"app": "web"}},
+			op:       model.OperationTypePause,
+			want:     []string{"fake:web-1", "fake:web-2", "fake:web-3"},
+		},
+		{
+			name:     "pause running",
+			selector: Selector{Labels: map[string]string{"app": "web"}, State: "running"},
+			op:       model.OperationTypePause,
+			want:     []string{"fake:web-1", "fake:web-2"},
+		},
+		{
+			name:     "vms left out without type",
+			selector: Selector{Labels: map[string]string{"zone": "a"}},
+			op:       model.OperationTypePause,
+			want:     []string{},
+		},
+		{
+			name:     "vms by type",
+			selector: Selector{Type: "vm", Labels: map[string]string{"zone": "a"}},
+			op:       model.OperationTypePause,
+			want:     []string{"fake:node1"},
+		},
+		{
+			name:     "containers on node",
+			selector: Selector{Name: "*-[12]", Ancestors: []Selector{{Type: "vm", Name: "node1"}}},
+			op:       model.OperationTypePause,
+			want:     []string{"fake:web-1", "fake:web-2"},
+		},
+		{
+			name:     "qualified name",
+			selector: Selector{Name: "fake:db-*"},
+			op:       model.OperationTypePause,
+			want:     []string{"fake:db-1"},
+		},
+	}
+	for _, tt := range tests {
+		sc, _, _ := newTestScheduler(t, testEntities())
+		entities, err := sc.entitiesBySelector(&tt.selector, tt.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(entities))
+		for _, e := range entities {
+			got = append(got, e.Name())
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: selected %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: selected %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
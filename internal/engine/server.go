@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -13,9 +14,11 @@ import (
 const bindAddress = "0.0.0.0:7933"
 
 type (
-	// Server serves API
+	// Server serves API. Endpoints without version
+	// are kept for the existing clients.
 	Server struct {
 		scheduler *Scheduler
+		scenarios *scenarios
 	}
 
 	scheduleTaskRequest struct {
@@ -23,6 +26,30 @@ type (
 		IntMax      string `json:"int_max,omitempty"`
 		FilterKey   string `json:"filter_key,omitempty"`
 		FilterValue string `json:"filter_value,omitempty"`
+		Operation   string `json:"operation,omitempty"`
+		// Params of the operation, driver's defaults are used for missing ones
+		Params map[string]string `json:"params,omitempty"`
+		// Selector selects entities to do operation on,
+		// FilterKey and FilterValue are added to its labels
+		Selector *Selector `json:"selector,omitempty"`
+		// MaxAffected limits number of entities task keeps affected at once
+		MaxAffected int `json:"max_affected,omitempty"`
+	}
+
+	revertRequest struct {
+		EntityID string `json:"entity_id"`
+	}
+
+	revertResponse struct {
+		Reverted int    `json:"reverted"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	statsResponse struct {
+		Running bool         `json:"running"`
+		Tasks   []TaskStatus `json:"tasks"`
+		// Degraded is number of degraded tasks
+		Degraded int `json:"degraded"`
 	}
 
 	versionResponse struct {
@@ -36,7 +63,10 @@ type (
 
 // NewServer returns a new Server
 func NewServer(scheduler *Scheduler) *Server {
-	return &Server{scheduler: scheduler}
+	return &Server{
+		scheduler: scheduler,
+		scenarios: newScenarios(),
+	}
 }
 
 // StartServer start serving
@@ -54,12 +84,13 @@ func (srv *Server) StartServer() error {
 
 func (srv *Server) webServerHandlers(bindAddr string) *http.ServeMux {
 	mux := http.NewServeMux()
+	mux.Handle(apiPrefix+"/", &apiRouter{routes: srv.routes()})
 
 	mux.HandleFunc("/schedule_task", func(w http.ResponseWriter, r *http.Request) {
 		srv.handleScheduleTask(w, r)
 	})
 	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		// ss.handleStats(w, r)
+		srv.handleStats(w, r)
 	})
 	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
 		srv.handleStop(w, r)
@@ -70,6 +101,21 @@ func (srv *Server) webServerHandlers(bindAddr string) *http.ServeMux {
 	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
 		srv.handleStart(w, r)
 	})
+	mux.HandleFunc("/tree", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleTree(w, r)
+	})
+	mux.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleCapabilities(w, r)
+	})
+	mux.HandleFunc("/undos", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleUndos(w, r)
+	})
+	mux.HandleFunc("/revert", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleRevert(w, r)
+	})
+	mux.HandleFunc("/revert_all", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleRevertAll(w, r)
+	})
 	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
 		srv.handleVersion(w, r)
 	})
@@ -96,7 +142,27 @@ func (srv *Server) handleScheduleTask(w http.ResponseWriter, r *http.Request) {
 	}
 	glog.Infof("Got schedule task request %+v.", *str)
 
-	err = srv.scheduler.ScheduleTask(str.IntMin, str.IntMax, model.OperationTypeDestroy, str.FilterKey, str.FilterValue)
+	operation := model.OperationTypeDestroy
+	if str.Operation != "" {
+		operation, err = model.ParseOperationType(str.Operation)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	selector := Selector{}
+	if str.Selector != nil {
+		selector = *str.Selector
+	}
+	if str.FilterKey != "" {
+		if selector.Labels == nil {
+			selector.Labels = make(map[string]string)
+		}
+		selector.Labels[str.FilterKey] = str.FilterValue
+	}
+	op := model.Operation{Type: operation, Params: str.Params}
+	err = srv.scheduler.ScheduleTask(str.IntMin, str.IntMax, op, selector, str.MaxAffected)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
@@ -143,6 +209,144 @@ func (srv *Server) handleClear(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Return state of the tasks, degraded ones included
+func (srv *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	resp := statsResponse{
+		Running: srv.scheduler.Running(),
+		Tasks:   srv.scheduler.Tasks(),
+	}
+	for _, task := range resp.Tasks {
+		if task.Degraded {
+			resp.Degraded++
+		}
+	}
+	respB, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respB)
+}
+
+// Return all the entities as a tree
+func (srv *Server) handleTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	tree, err := srv.scheduler.Tree()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	respB, err := json.Marshal(tree)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respB)
+}
+
+// Return operations playgrounds support and their parameters
+func (srv *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	respB, err := json.Marshal(srv.scheduler.Capabilities())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respB)
+}
+
+// Return operations that can be reverted
+func (srv *Server) handleUndos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	respB, err := json.Marshal(srv.scheduler.Undos())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respB)
+}
+
+// Revert operations done on the entity
+func (srv *Server) handleRevert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &revertRequest{}
+	if err = json.Unmarshal(b, req); err != nil || req.EntityID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("entity_id must be specified"))
+		return
+	}
+	glog.Infof("Got revert request for entity %s.", req.EntityID)
+	// reverting shouldn't stop halfway if client goes away
+	reverted, err := srv.scheduler.RevertEntity(context.Background(), req.EntityID)
+	srv.writeRevertResponse(w, reverted, err)
+}
+
+// Revert all the operations
+func (srv *Server) handleRevertAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	glog.Info("Got revert all request.")
+	reverted, err := srv.scheduler.RevertAll(context.Background())
+	srv.writeRevertResponse(w, reverted, err)
+}
+
+func (srv *Server) writeRevertResponse(w http.ResponseWriter, reverted int, err error) {
+	resp := revertResponse{Reverted: reverted}
+	status := http.StatusOK
+	if err != nil {
+		resp.Error = err.Error()
+		status = http.StatusInternalServerError
+		if err == ErrNothingToRevert {
+			status = http.StatusNotFound
+		}
+	}
+	respB, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(respB)
+}
+
 func (srv *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -0,0 +1,274 @@
+package engine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livepeer/swarm-chaos/internal/engine/drivers/fake"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// newTestServer starts server of scheduler of engine with fake
+// playground named fake of the test entities, on the real clock
+func newTestServer(t *testing.T) (*httptest.Server, *Scheduler) {
+	t.Helper()
+	fp, err := fake.NewFakePlayground(testEntities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce := NewChaosEngine()
+	if err := ce.AddPlayground("fake", fp); err != nil {
+		t.Fatal(err)
+	}
+	sc := NewScheduler(ce)
+	srv := NewServer(sc)
+	return httptest.NewServer(srv.webServerHandlers("")), sc
+}
+
+// request does request to the test server, returning status and body
+func request(t *testing.T, ts *httptest.Server, method, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+// TestAPI does requests one by one, each step seeing state left by the previous ones
+func TestAPI(t *testing.T) {
+	ts, sc := newTestServer(t)
+	defer ts.Close()
+	defer sc.StopTasks()
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		// wantBody is substring of the response
+		wantBody string
+	}{
+		{method: "GET", path: "/v1/tasks", wantStatus: http.StatusOK, wantBody: "[]"},
+		{method: "POST", path: "/v1/tasks", body: `{"int_min":`, wantStatus: http.StatusBadRequest},
+		{method: "POST", path: "/v1/tasks", body: `{"int_min":"1h","int_max":"2h","operation":"explode"}`, wantStatus: http.StatusBadRequest},
+		{method: "POST", path: "/v1/tasks", body: `{"int_min":"1h","int_max":"2h","selector":{"state":"paused"}}`, wantStatus: http.StatusBadRequest},
+		{
+			method:     "POST",
+			path:       "/v1/tasks",
+			body:       `{"int_min":"1h","int_max":"2h","operation":"pause","selector":{"labels":{"app":"web"}},"max_affected":1}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `"id":0`,
+		},
+		{method: "GET", path: "/v1/tasks/0", wantStatus: http.StatusOK, wantBody: `"max_affected":1`},
+		{method: "GET", path: "/v1/tasks/7", wantStatus: http.StatusNotFound},
+		{method: "GET", path: "/v1/tasks/x", wantStatus: http.StatusBadRequest},
+		{method: "PATCH", path: "/v1/tasks/0", wantStatus: http.StatusMethodNotAllowed},
+		{method: "PUT", path: "/v1/scheduler", body: `{"running":true}`, wantStatus: http.StatusOK, wantBody: `"running":true`},
+		{method: "GET", path: "/v1/tasks/0", wantStatus: http.StatusOK, wantBody: `"running":true`},
+		{method: "PUT", path: "/v1/scheduler", body: `{"running":false}`, wantStatus: http.StatusOK, wantBody: `"running":false`},
+		{method: "DELETE", path: "/v1/tasks/0", wantStatus: http.StatusNoContent},
+		{method: "DELETE", path: "/v1/tasks/0", wantStatus: http.StatusNotFound},
+		{method: "GET", path: "/v1/entities?label=app=web&state=running", wantStatus: http.StatusOK, wantBody: `"name":"fake:web-2"`},
+		{method: "GET", path: "/v1/entities?label=app", wantStatus: http.StatusBadRequest},
+		{method: "GET", path: "/v1/entities?status=maybe", wantStatus: http.StatusBadRequest},
+		{method: "GET", path: "/v1/entities/fake:c3", wantStatus: http.StatusOK, wantBody: `"name":"fake:web-3"`},
+		{method: "GET", path: "/v1/entities/fake:c9", wantStatus: http.StatusNotFound},
+		{method: "GET", path: "/v1/faults", wantStatus: http.StatusOK, wantBody: "[]"},
+		{method: "DELETE", path: "/v1/faults", wantStatus: http.StatusOK, wantBody: `"reverted":0`},
+		{method: "DELETE", path: "/v1/faults/5", wantStatus: http.StatusNotFound},
+		{method: "GET", path: "/v1/events?limit=-1", wantStatus: http.StatusBadRequest},
+		{method: "GET", path: "/v1/capabilities", wantStatus: http.StatusOK, wantBody: `"operation":"pause"`},
+		// fake playground doesn't track health of its nodes
+		{method: "GET", path: "/v1/health", wantStatus: http.StatusOK, wantBody: "[]"},
+		{method: "GET", path: "/v1/scheduler", wantStatus: http.StatusOK, wantBody: `"unhealthy_nodes":0`},
+		{
+			method:     "POST",
+			path:       "/v1/scenarios",
+			body:       `{"name":"web","tasks":[{"int_min":"1h","int_max":"1h","operation":"stop","selector":{"name":"web-*"}}]}`,
+			wantStatus: http.StatusCreated,
+		},
+		{method: "POST", path: "/v1/scenarios", body: `{"name":"web","tasks":[{"int_min":"1h","int_max":"1h"}]}`, wantStatus: http.StatusConflict},
+		{method: "PUT", path: "/v1/scenarios/bad", body: `{"tasks":[{"int_min":"1h","int_max":"1m"}]}`, wantStatus: http.StatusBadRequest},
+		{method: "POST", path: "/v1/scenarios/web/run", wantStatus: http.StatusOK, wantBody: `"id":1`},
+		{method: "GET", path: "/v1/scheduler", wantStatus: http.StatusOK, wantBody: `"running":true`},
+		{method: "DELETE", path: "/v1/tasks", wantStatus: http.StatusNoContent},
+		{method: "GET", path: "/v1/scheduler", wantStatus: http.StatusOK, wantBody: `"tasks":0`},
+		// legacy endpoints
+		{method: "POST", path: "/schedule_task", body: `{"int_min":"1h","int_max":"2h","filter_key":"app","filter_value":"db"}`, wantStatus: http.StatusOK},
+		{method: "POST", path: "/schedule_task", body: `{"int_min":"2h","int_max":"1h"}`, wantStatus: http.StatusBadRequest},
+		{method: "GET", path: "/stats", wantStatus: http.StatusOK, wantBody: `"id":2`},
+		{method: "POST", path: "/start", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		status, body := request(t, ts, tt.method, tt.path, tt.body)
+		if status != tt.wantStatus {
+			t.Errorf("%s %s: status %d, want %d, body %s", tt.method, tt.path, status, tt.wantStatus, body)
+			continue
+		}
+		if !strings.Contains(body, tt.wantBody) {
+			t.Errorf("%s %s: body %s, want %s in it", tt.method, tt.path, body, tt.wantBody)
+		}
+	}
+}
+
+func TestListEntities(t *testing.T) {
+	ts, _ := newTestServer(t)
+	defer ts.Close()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// vms are only listed by type
+		{query: "", want: []string{"fake:web-1", "fake:web-2", "fake:web-3", "fake:db-1"}},
+		{query: "type=vm", want: []string{"fake:node1", "fake:node2"}},
+		{query: "name=web-*&state=running", want: []string{"fake:web-1", "fake:web-2"}},
+		{query: "parent=zone=b", want: []string{"fake:db-1"}},
+		{query: "playground=other", want: []string{}},
+	}
+	for _, tt := range tests {
+		status, body := request(t, ts, "GET", "/v1/entities?"+tt.query, "")
+		if status != http.StatusOK {
+			t.Errorf("Entities %q: status %d, body %s", tt.query, status, body)
+			continue
+		}
+		entities := make([]EntityInfo, 0)
+		if err := json.Unmarshal([]byte(body), &entities); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(entities))
+		for _, e := range entities {
+			got = append(got, e.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Entities %q: %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestLoadScenarios(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+		// want are names of the scenarios listed after loading
+		want []string
+	}{
+		{
+			name: "ok",
+			file: `[{"name":"web","tasks":[{"int_min":"1m","int_max":"2m","operation":"pause","selector":{"name":"web-*"}}]},
+				{"name":"db","description":"db outage","tasks":[{"int_min":"1h","int_max":"1h","selector":{"labels":{"app":"db"}}}]}]`,
+			want: []string{"db", "web"},
+		},
+		{name: "not array", file: `{"name":"web"}`, wantErr: true},
+		{name: "no tasks", file: `[{"name":"web","tasks":[]}]`, wantErr: true},
+		{
+			name:    "bad param",
+			file:    `[{"name":"web","tasks":[{"int_min":"1m","int_max":"2m","operation":"pause","params":{"duration":"-5s"}}]}]`,
+			wantErr: true,
+		},
+		{
+			name: "listed twice",
+			file: `[{"name":"web","tasks":[{"int_min":"1m","int_max":"1m"}]},
+				{"name":"web","tasks":[{"int_min":"2m","int_max":"2m"}]}]`,
+			wantErr: true,
+		},
+	}
+	dir, err := ioutil.TempDir("", "scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".json")
+		if err := ioutil.WriteFile(path, []byte(tt.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fp, err := fake.NewFakePlayground(testEntities())
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := NewServer(NewScheduler(fp))
+		scenarios, err := LoadScenarios(path)
+		if err == nil {
+			err = srv.AddScenarios(scenarios)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		got := make([]string, 0)
+		for _, s := range srv.scenarios.list() {
+			got = append(got, s.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: scenarios %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// processesHidden is fake playground not listing processes, like docker
+type processesHidden struct {
+	*fake.FakePlayground
+}
+
+func (ph processesHidden) Entities() ([]model.Entity, error) {
+	entities, err := ph.FakePlayground.Entities()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.Entity, 0, len(entities))
+	for _, e := range entities {
+		if e.Type() != model.EntityTypeProcess {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func TestGetProcess(t *testing.T) {
+	configs := append(testEntities(), fake.EntityConfig{ID: "c1/7", Name: "ffmpeg", Type: "process", Parent: "c1"})
+	fp, err := fake.NewFakePlayground(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce := NewChaosEngine()
+	if err := ce.AddPlayground("fake", processesHidden{fp}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewServer(NewScheduler(ce)).webServerHandlers(""))
+	defer ts.Close()
+	tests := []struct {
+		id         string
+		wantStatus int
+		wantBody   string
+	}{
+		{id: "fake:c1%2F7", wantStatus: http.StatusOK, wantBody: `"parent":"fake:c1"`},
+		{id: "fake:c1%2F8", wantStatus: http.StatusNotFound},
+		{id: "fake:c2%2F7", wantStatus: http.StatusNotFound},
+		{id: "fake:c1", wantStatus: http.StatusOK, wantBody: `"name":"fake:web-1"`},
+	}
+	for _, tt := range tests {
+		status, body := request(t, ts, "GET", "/v1/entities/"+tt.id, "")
+		if status != tt.wantStatus {
+			t.Errorf("Entity %s: status %d, want %d, body %s", tt.id, status, tt.wantStatus, body)
+			continue
+		}
+		if !strings.Contains(body, tt.wantBody) {
+			t.Errorf("Entity %s: body %s, want %s in it", tt.id, body, tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+type (
+	// SimClock is a virtual clock for simulations. Time moves only
+	// when clock is set forward or waited on, waiting takes no real time.
+	SimClock struct {
+		mu  sync.Mutex
+		now time.Time
+	}
+)
+
+// NewSimClock creates a virtual clock starting at start
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After advances the clock by d and returns channel
+// that already has the new time
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// Set moves the clock forward to t, the clock never goes back
+func (c *SimClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// Simulate runs scheduled tasks for duration of virtual time of the
+// clock and returns timeline of what happened. Tasks are run one by
+// one in a single goroutine, so with the same seed simulation gives
+// the same timeline. Operations are really done, so playground should
+// be a fake one using the same clock. Simulation runs copies of the
+// tasks, so undos and health of the scheduler are not changed by it.
+func (sc *Scheduler) Simulate(clock *SimClock, duration time.Duration, seed int64) ([]Event, error) {
+	sim := &Scheduler{
+		playground: sc.playground,
+		clock:      clock,
+		rand:       rand.New(rand.NewSource(seed)),
+		journal:    NewJournal(0),
+	}
+	sc.mu.Lock()
+	if sc.running {
+		sc.mu.Unlock()
+		return nil, fmt.Errorf("Can't simulate while tasks are running")
+	}
+	for _, t := range sc.tasks {
+		sim.tasks = append(sim.tasks, &task{
+			id:          t.id,
+			interval:    t.interval,
+			operation:   t.operation,
+			selector:    t.selector,
+			maxAffected: t.maxAffected,
+		})
+	}
+	// status changes observed by the playground go to the timeline
+	sc.simJournal = sim.journal
+	sc.mu.Unlock()
+	defer func() {
+		sc.mu.Lock()
+		sc.simJournal = nil
+		sc.mu.Unlock()
+	}()
+
+	sim.simulate(clock, duration)
+	return sim.journal.Events(), nil
+}
+
+// simulate runs tasks of the scheduler one by one
+// for duration of virtual time of the clock
+func (sc *Scheduler) simulate(clock *SimClock, duration time.Duration) {
+	start := clock.Now()
+	end := start.Add(duration)
+	next := make([]time.Time, len(sc.tasks))
+	affected := make([]affectedEntities, len(sc.tasks))
+	for i, task := range sc.tasks {
+		affected[i] = make(affectedEntities)
+		next[i] = start.Add(sc.nextWait(task))
+	}
+	glog.Infof("Simulating %d tasks for %s", len(sc.tasks), duration)
+	for {
+		i := -1
+		for j := range next {
+			if i < 0 || next[j].Before(next[i]) {
+				i = j
+			}
+		}
+		if i < 0 || next[i].After(end) {
+			break
+		}
+		clock.Set(next[i])
+		sc.runTask(context.Background(), sc.tasks[i], affected[i])
+		// operations may take virtual time too
+		next[i] = clock.Now().Add(sc.nextWait(sc.tasks[i]))
+	}
+	clock.Set(end)
+}
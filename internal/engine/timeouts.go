@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+// OperationTimeout limits how long operation on the entity may take
+var OperationTimeout = 30 * time.Second
+
+// OperationTimeouts overrides OperationTimeout for particular operations
+var OperationTimeouts = map[model.OperationType]time.Duration{}
+
+// StatusTimeout limits getting status of the entity
+var StatusTimeout = 10 * time.Second
+
+func operationTimeout(operation model.OperationType) time.Duration {
+	if timeout, has := OperationTimeouts[operation]; has {
+		return timeout
+	}
+	return OperationTimeout
+}
+
+// ParseOperationTimeouts sets operation timeouts from the comma-separated
+// list of durations, like "30s,destroy=10s,stress_cpu=2m". Duration
+// without operation name sets timeout of all the other operations.
+func ParseOperationTimeouts(spec string) error {
+	timeouts := make(map[model.OperationType]time.Duration)
+	def := OperationTimeout
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := "", part
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], part[i+1:]
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("Bad timeout %q", part)
+		}
+		if name == "" {
+			def = timeout
+			continue
+		}
+		operation, err := model.ParseOperationType(name)
+		if err != nil {
+			return err
+		}
+		timeouts[operation] = timeout
+	}
+	OperationTimeout = def
+	OperationTimeouts = timeouts
+	return nil
+}
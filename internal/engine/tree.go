@@ -0,0 +1,38 @@
+package engine
+
+import "github.com/livepeer/swarm-chaos/internal/model"
+
+type (
+	// TreeNode represents entity and its descendants
+	TreeNode struct {
+		ID     string            `json:"id,omitempty"`
+		Name   string            `json:"name,omitempty"`
+		Type   string            `json:"type,omitempty"`
+		Labels map[string]string `json:"labels,omitempty"`
+		Childs []*TreeNode       `json:"childs,omitempty"`
+	}
+)
+
+// buildTree returns trees rooted at entities without parent
+func buildTree(entities []model.Entity) []*TreeNode {
+	res := make([]*TreeNode, 0)
+	for _, e := range entities {
+		if e.Parent() == nil {
+			res = append(res, newTreeNode(e))
+		}
+	}
+	return res
+}
+
+func newTreeNode(e model.Entity) *TreeNode {
+	tn := &TreeNode{
+		ID:     e.ID(),
+		Name:   e.Name(),
+		Type:   e.Type().String(),
+		Labels: e.Labels(),
+	}
+	for _, c := range e.Childs() {
+		tn.Childs = append(tn.Childs, newTreeNode(c))
+	}
+	return tn
+}
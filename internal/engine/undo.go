@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/swarm-chaos/internal/model"
+)
+
+type (
+	// pendingUndo is undo handle of the operation done by a task
+	// and not reverted yet
+	pendingUndo struct {
+		id        int
+		task      int
+		entityID  string
+		entity    string
+		operation model.Operation
+		since     time.Time
+		undo      model.Undo
+	}
+
+	// UndoStatus is outstanding undo reported by the API
+	UndoStatus struct {
+		ID        int       `json:"id"`
+		Task      int       `json:"task"`
+		EntityID  string    `json:"entity_id"`
+		Entity    string    `json:"entity"`
+		Operation string    `json:"operation"`
+		Undo      string    `json:"undo"`
+		Since     time.Time `json:"since"`
+	}
+)
+
+// ErrNothingToRevert is returned when entity has no outstanding undos
+var ErrNothingToRevert = errors.New("Nothing to revert")
+
+// doReversible does operation on the entity, returning
+// undo handle if entity can revert the operation
+func doReversible(ctx context.Context, e model.Entity, operation model.Operation) (model.Undo, error) {
+	if reversible, ok := e.(model.Reversible); ok {
+		return reversible.DoReversible(ctx, operation)
+	}
+	return nil, e.Do(ctx, operation)
+}
+
+func (sc *Scheduler) addUndo(task *task, e model.Entity, undo model.Undo) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.lastUndoID++
+	sc.undos = append(sc.undos, &pendingUndo{
+		id:        sc.lastUndoID,
+		task:      task.id,
+		entityID:  e.ID(),
+		entity:    e.Name(),
+		operation: task.operation,
+		since:     sc.clock.Now(),
+		undo:      undo,
+	})
+}
+
+// forgetUndos drops undos of the task's operations on the entity,
+// as entity recovered by itself
+func (sc *Scheduler) forgetUndos(task *task, entityID string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	kept := make([]*pendingUndo, 0, len(sc.undos))
+	for _, pu := range sc.undos {
+		if pu.task != task.id || pu.entityID != entityID {
+			kept = append(kept, pu)
+		}
+	}
+	sc.undos = kept
+}
+
+// Undos returns outstanding undos, oldest first
+func (sc *Scheduler) Undos() []UndoStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	res := make([]UndoStatus, 0, len(sc.undos))
+	for _, pu := range sc.undos {
+		res = append(res, UndoStatus{
+			ID:        pu.id,
+			Task:      pu.task,
+			EntityID:  pu.entityID,
+			Entity:    pu.entity,
+			Operation: pu.operation.String(),
+			Undo:      pu.undo.String(),
+			Since:     pu.since,
+		})
+	}
+	return res
+}
+
+// Undo returns outstanding undo with the id
+func (sc *Scheduler) Undo(id int) (UndoStatus, error) {
+	for _, us := range sc.Undos() {
+		if us.ID == id {
+			return us, nil
+		}
+	}
+	return UndoStatus{}, ErrNothingToRevert
+}
+
+// RevertEntity reverts outstanding operations done on the entity,
+// latest first. Returns number of operations reverted.
+func (sc *Scheduler) RevertEntity(ctx context.Context, entityID string) (int, error) {
+	return sc.revert(ctx, func(pu *pendingUndo) bool {
+		return pu.entityID == entityID
+	})
+}
+
+// RevertUndo reverts operation of the outstanding undo with the id
+func (sc *Scheduler) RevertUndo(ctx context.Context, id int) (int, error) {
+	return sc.revert(ctx, func(pu *pendingUndo) bool {
+		return pu.id == id
+	})
+}
+
+// RevertAll reverts all the outstanding operations, latest first.
+// Returns number of operations reverted.
+func (sc *Scheduler) RevertAll(ctx context.Context) (int, error) {
+	reverted, err := sc.revert(ctx, func(pu *pendingUndo) bool {
+		return true
+	})
+	if err == ErrNothingToRevert {
+		return 0, nil
+	}
+	return reverted, err
+}
+
+// revert reverts undos matching match. Undos that failed are kept,
+// so they can be retried, unless entity is gone.
+func (sc *Scheduler) revert(ctx context.Context, match func(*pendingUndo) bool) (int, error) {
+	sc.mu.Lock()
+	selected := make([]*pendingUndo, 0)
+	kept := make([]*pendingUndo, 0, len(sc.undos))
+	for _, pu := range sc.undos {
+		if match(pu) {
+			selected = append(selected, pu)
+		} else {
+			kept = append(kept, pu)
+		}
+	}
+	sc.undos = kept
+	sc.mu.Unlock()
+	if len(selected) == 0 {
+		return 0, ErrNothingToRevert
+	}
+
+	reverted := 0
+	failed := make([]*pendingUndo, 0)
+	var lastErr error
+	for i := len(selected) - 1; i >= 0; i-- {
+		pu := selected[i]
+		what := fmt.Sprintf("Reverting %s of entity %s", pu.operation, pu.entity)
+		attempts, err := sc.retry(ctx, what, func() error {
+			opCtx, cancel := context.WithTimeout(ctx, operationTimeout(model.OperationTypeResume))
+			defer cancel()
+			return pu.undo.Undo(opCtx)
+		})
+		msg := pu.undo.String()
+		if err != nil {
+			class := model.ClassifyError(err)
+			glog.Infof("%s failed after %d attempts: %v", what, attempts, err)
+			msg = fmt.Sprintf("%s %s error after %d attempts: %v", msg, class, attempts, err)
+			if class != model.ErrorClassGone {
+				failed = append(failed, pu)
+				lastErr = fmt.Errorf("%s: %v", what, err)
+			}
+		} else {
+			glog.Infof("Reverted %s of entity %s by %s", pu.operation, pu.entity, pu.undo)
+			reverted++
+		}
+		sc.journal.Add(Event{
+			Time:      sc.clock.Now(),
+			Type:      EventRevert,
+			Task:      pu.task,
+			EntityID:  pu.entityID,
+			Entity:    pu.entity,
+			Operation: pu.operation.String(),
+			Message:   msg,
+		})
+	}
+	if len(failed) > 0 {
+		sc.mu.Lock()
+		sc.undos = append(sc.undos, failed...)
+		sort.Slice(sc.undos, func(i, j int) bool { return sc.undos[i].id < sc.undos[j].id })
+		sc.mu.Unlock()
+	}
+	return reverted, lastErr
+}
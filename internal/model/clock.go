@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type (
+	// Clock tells time and waits, so virtual time can be
+	// used instead of the real one in simulations
+	Clock interface {
+		Now() time.Time
+		After(d time.Duration) <-chan time.Time
+	}
+
+	realClock struct{}
+)
+
+// RealClock is the system clock
+var RealClock Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -1,5 +1,11 @@
 package model
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 type EntityType int
 type OperationType int
 type StatusType int
@@ -9,6 +15,8 @@ const (
 	EntityTypeProcess
 	EntityTypeNetworkLink
 	EntityTypeVM
+	EntityTypeTask
+	EntityTypeWorkload
 
 	OperationTypeDestroy OperationType = iota
 	OperationTypeStart
@@ -16,6 +24,19 @@ const (
 	OperationTypePause
 	OperationTypeResume
 	OperationTypeSlowdown
+	OperationTypeDrain
+	OperationTypeKill
+	OperationTypeRestart
+	OperationTypeStressCPU
+	OperationTypeStressMemory
+	OperationTypeStressDisk
+	OperationTypeBlackhole
+	OperationTypeThrottle
+	OperationTypeSkewClock
+	OperationTypeTimeout
+	OperationTypeReset
+	OperationTypeSlice
+	OperationTypeScaleDown
 
 	StatusTypeWorking StatusType = iota
 	StatusTypeDestroyed
@@ -26,13 +47,18 @@ const (
 
 type (
 	// Entity represents singles object manageable by Swarm Chaos
+	// Entities form a tree (swarm node -> service task -> container -> processes),
+	// navigable through Parent and Childs. Do and Status should give up
+	// when ctx is done.
 	Entity interface {
+		ID() string
 		Name() string
 		Labels() map[string]string
+		Parent() Entity
 		Childs() []Entity
 		Type() EntityType
-		Do(operation OperationType) error
-		Status() (StatusType, error)
+		Do(ctx context.Context, operation Operation) error
+		Status(ctx context.Context) (StatusType, error)
 	}
 
 	// Playground represents all the entities that Swarm Chaos can work with.
@@ -41,12 +67,171 @@ type (
 		// EntitiesByLabel(key, value string) ([]Entity, error)
 	}
 
+	// Query narrows entities listed by the playground. Playground
+	// may return more entities than asked for, so result should
+	// still be filtered, query only makes listing cheaper.
+	Query struct {
+		// Types of the entities, any if empty
+		Types []EntityType
+		// Labels entities should have
+		Labels map[string]string
+		// Name is a glob pattern matched against entity's name
+		Name string
+		// Running leaves out stopped, paused and destroyed entities
+		Running bool
+		// Playground is name of the playground, used by playgrounds
+		// that combine several named ones
+		Playground string
+	}
+
+	// Querier is implemented by playgrounds that can list
+	// entities by query more efficiently than all of them
+	Querier interface {
+		Query(query Query) ([]Entity, error)
+	}
+
 	// Task represents taks
 	// Task interface {
 	// 	Start() (chan interface{}, error)
 	// }
 )
 
+// HasType returns true if query selects entities of the type
+func (q *Query) HasType(et EntityType) bool {
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == et {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrOperationNotSupported is returned by entities for operations they can't do
+var ErrOperationNotSupported = errors.New("operation not supported")
+
+var entityTypeNames = map[EntityType]string{
+	EntityTypeContainer:   "container",
+	EntityTypeProcess:     "process",
+	EntityTypeNetworkLink: "network_link",
+	EntityTypeVM:          "vm",
+	EntityTypeTask:        "task",
+	EntityTypeWorkload:    "workload",
+}
+
+var statusNames = map[StatusType]string{
+	StatusTypeWorking:   "working",
+	StatusTypeDestroyed: "destroyed",
+	StatusTypeStopped:   "stopped",
+	StatusTypePaused:    "paused",
+	StatusTypeSlow:      "slow",
+}
+
+var operationNames = map[OperationType]string{
+	OperationTypeDestroy:      "destroy",
+	OperationTypeStart:        "start",
+	OperationTypeStop:         "stop",
+	OperationTypePause:        "pause",
+	OperationTypeResume:       "resume",
+	OperationTypeSlowdown:     "slowdown",
+	OperationTypeDrain:        "drain",
+	OperationTypeKill:         "kill",
+	OperationTypeRestart:      "restart",
+	OperationTypeStressCPU:    "stress_cpu",
+	OperationTypeStressMemory: "stress_memory",
+	OperationTypeStressDisk:   "stress_disk",
+	OperationTypeBlackhole:    "blackhole",
+	OperationTypeThrottle:     "throttle",
+	OperationTypeSkewClock:    "skew_clock",
+	OperationTypeTimeout:      "timeout",
+	OperationTypeReset:        "reset",
+	OperationTypeSlice:        "slice",
+	OperationTypeScaleDown:    "scale_down",
+}
+
+func (et EntityType) String() string {
+	if name, has := entityTypeNames[et]; has {
+		return name
+	}
+	return fmt.Sprintf("entity(%d)", int(et))
+}
+
+// ParseEntityType returns entity type by its name
+func ParseEntityType(name string) (EntityType, error) {
+	for et, n := range entityTypeNames {
+		if n == name {
+			return et, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown entity type %q", name)
+}
+
+// MarshalText makes entity type marshaled to JSON as its name
+func (et EntityType) MarshalText() ([]byte, error) {
+	return []byte(et.String()), nil
+}
+
+// UnmarshalText parses entity type from its name
+func (et *EntityType) UnmarshalText(text []byte) error {
+	t, err := ParseEntityType(string(text))
+	if err != nil {
+		return err
+	}
+	*et = t
+	return nil
+}
+
+func (st StatusType) String() string {
+	if name, has := statusNames[st]; has {
+		return name
+	}
+	return fmt.Sprintf("status(%d)", int(st))
+}
+
+// ParseStatusType returns status by its name
+func ParseStatusType(name string) (StatusType, error) {
+	for st, n := range statusNames {
+		if n == name {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown status %q", name)
+}
+
+func (ot OperationType) String() string {
+	if name, has := operationNames[ot]; has {
+		return name
+	}
+	return fmt.Sprintf("operation(%d)", int(ot))
+}
+
+// ParseOperationType returns operation by its name
+func ParseOperationType(name string) (OperationType, error) {
+	for ot, n := range operationNames {
+		if n == name {
+			return ot, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown operation %q", name)
+}
+
+// MarshalText makes operation marshaled to JSON as its name
+func (ot OperationType) MarshalText() ([]byte, error) {
+	return []byte(ot.String()), nil
+}
+
+// UnmarshalText parses operation from its name
+func (ot *OperationType) UnmarshalText(text []byte) error {
+	t, err := ParseOperationType(string(text))
+	if err != nil {
+		return err
+	}
+	*ot = t
+	return nil
+}
+
 // SwarmChaosVersion version
 // content of this constant will be set at build time,
 // using -ldflags, combining content of `VERSION` file and
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// ErrorClass tells how error of the operation should be handled
+type ErrorClass int
+
+const (
+	// ErrorClassPermanent errors won't go away if operation is retried
+	ErrorClassPermanent ErrorClass = iota
+	// ErrorClassTransient errors are API or network failures worth retrying
+	ErrorClassTransient
+	// ErrorClassGone errors mean entity doesn't exist anymore
+	ErrorClassGone
+)
+
+type classifiedError struct {
+	err   error
+	class ErrorClass
+}
+
+var errorClassNames = map[ErrorClass]string{
+	ErrorClassPermanent: "permanent",
+	ErrorClassTransient: "transient",
+	ErrorClassGone:      "gone",
+}
+
+func (ec ErrorClass) String() string {
+	if name, has := errorClassNames[ec]; has {
+		return name
+	}
+	return "unknown"
+}
+
+func (ce *classifiedError) Error() string {
+	return ce.err.Error()
+}
+
+func (ce *classifiedError) Unwrap() error {
+	return ce.err
+}
+
+// TransientError marks err as worth retrying
+func TransientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ErrorClassTransient}
+}
+
+// GoneError marks err as caused by entity that doesn't exist anymore
+func GoneError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ErrorClassGone}
+}
+
+// ClassifyError returns class of the error. Drivers mark errors of their
+// APIs with TransientError and GoneError, network errors and timeouts
+// are transient anyway, everything else is permanent.
+func ClassifyError(err error) ErrorClass {
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrOperationNotSupported), errors.Is(err, context.Canceled):
+		return ErrorClassPermanent
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return ErrorClassTransient
+	}
+	return ErrorClassPermanent
+}
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamType is type of the operation parameter's value
+type ParamType string
+
+const (
+	ParamTypeString   ParamType = "string"
+	ParamTypeInt      ParamType = "int"
+	ParamTypeFloat    ParamType = "float"
+	ParamTypeDuration ParamType = "duration"
+	ParamTypeSignal   ParamType = "signal"
+)
+
+type (
+	// Operation is operation with its parameters. Parameters
+	// not given take defaults of the driver.
+	Operation struct {
+		Type   OperationType     `json:"type"`
+		Params map[string]string `json:"params,omitempty"`
+	}
+
+	// ParamSpec describes parameter of the operation. Numbers and
+	// durations can't be negative unless AllowNegative is set.
+	ParamSpec struct {
+		Name        string    `json:"name"`
+		Type        ParamType `json:"type"`
+		Description string    `json:"description,omitempty"`
+		// Positive numbers and durations should be greater than zero
+		Positive      bool `json:"positive,omitempty"`
+		AllowNegative bool `json:"allow_negative,omitempty"`
+	}
+
+	// OperationSpec describes operation playground can do
+	// on entities of the types, and parameters it takes
+	OperationSpec struct {
+		Operation OperationType `json:"operation"`
+		Entities  []EntityType  `json:"entities"`
+		Params    []ParamSpec   `json:"params,omitempty"`
+		// Playground is name of the playground, set by the engine
+		Playground string `json:"playground,omitempty"`
+	}
+
+	// CapabilityReporter is implemented by playgrounds that can
+	// tell which operations and parameters they support
+	CapabilityReporter interface {
+		Capabilities() []OperationSpec
+	}
+)
+
+// Standard parameters, drivers use them for the same
+// things, so scenarios work with any of the drivers
+var (
+	ParamDuration = ParamSpec{Name: "duration", Type: ParamTypeDuration, Description: "How long the fault lasts", Positive: true}
+	ParamSignal   = ParamSpec{Name: "signal", Type: ParamTypeSignal, Description: "Signal to send, like SIGKILL"}
+	ParamTimeout  = ParamSpec{Name: "timeout", Type: ParamTypeDuration, Description: "How long to wait for graceful stop before killing"}
+	ParamDelay    = ParamSpec{Name: "delay", Type: ParamTypeDuration, Description: "Latency added to the traffic"}
+	ParamJitter   = ParamSpec{Name: "jitter", Type: ParamTypeDuration, Description: "Maximum random addition to the delay"}
+	ParamRate     = ParamSpec{Name: "rate", Type: ParamTypeString, Description: "Bandwidth cap, like 1mbit or 500kbit"}
+	ParamTargets  = ParamSpec{Name: "targets", Type: ParamTypeString, Description: "Comma-separated destinations made unreachable"}
+	ParamOffset   = ParamSpec{Name: "offset", Type: ParamTypeDuration, Description: "Offset the clock is shifted by, can be negative", AllowNegative: true}
+	ParamCPUs     = ParamSpec{Name: "cpus", Type: ParamTypeFloat, Description: "Number of CPUs", Positive: true}
+	ParamMemory   = ParamSpec{Name: "memory_mb", Type: ParamTypeInt, Description: "Memory in megabytes", Positive: true}
+	ParamDisk     = ParamSpec{Name: "disk_mb", Type: ParamTypeInt, Description: "Disk space in megabytes", Positive: true}
+	ParamBy       = ParamSpec{Name: "by", Type: ParamTypeInt, Description: "Number of replicas removed", Positive: true}
+)
+
+// StandardParams are all the standard parameters
+var StandardParams = []ParamSpec{
+	ParamDuration, ParamSignal, ParamTimeout, ParamDelay, ParamJitter, ParamRate,
+	ParamTargets, ParamOffset, ParamCPUs, ParamMemory, ParamDisk, ParamBy,
+}
+
+// NewOperation returns operation of the type without parameters
+func NewOperation(ot OperationType) Operation {
+	return Operation{Type: ot}
+}
+
+// ParseParams parses key=value parameters
+func ParseParams(params []string) (map[string]string, error) {
+	res := make(map[string]string, len(params))
+	for _, param := range params {
+		i := strings.Index(param, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Bad parameter %q, should be key=value", param)
+		}
+		res[param[:i]] = param[i+1:]
+	}
+	return res, nil
+}
+
+func (op Operation) String() string {
+	if len(op.Params) == 0 {
+		return op.Type.String()
+	}
+	names := make([]string, 0, len(op.Params))
+	for name := range op.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + op.Params[name]
+	}
+	return op.Type.String() + "(" + strings.Join(names, ", ") + ")"
+}
+
+// Param returns value of the parameter, or def if it is not given
+func (op Operation) Param(name, def string) string {
+	if v, has := op.Params[name]; has {
+		return v
+	}
+	return def
+}
+
+// Duration returns value of the duration parameter, or def if
+// it is not given or malformed. Values are checked by ValidateOperation.
+func (op Operation) Duration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(op.Params[name]); err == nil {
+		return d
+	}
+	return def
+}
+
+// Int returns value of the int parameter, or def if it is not given or malformed
+func (op Operation) Int(name string, def int) int {
+	if i, err := strconv.Atoi(op.Params[name]); err == nil {
+		return i
+	}
+	return def
+}
+
+// Float returns value of the float parameter, or def if it is not given or malformed
+func (op Operation) Float(name string, def float64) float64 {
+	if f, err := strconv.ParseFloat(op.Params[name], 64); err == nil {
+		return f
+	}
+	return def
+}
+
+// HasEntity returns true if operation can be done on entities of the type
+func (spec *OperationSpec) HasEntity(et EntityType) bool {
+	for _, t := range spec.Entities {
+		if t == et {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOperation checks that operation is one of the specs,
+// and its parameters are known and have values of right types
+func ValidateOperation(op Operation, specs []OperationSpec) error {
+	params := make(map[string]ParamSpec)
+	supported := false
+	for i := range specs {
+		if specs[i].Operation != op.Type {
+			continue
+		}
+		supported = true
+		for _, param := range specs[i].Params {
+			params[param.Name] = param
+		}
+	}
+	if !supported {
+		return fmt.Errorf("Operation %s is not supported", op.Type)
+	}
+	for name, value := range op.Params {
+		param, has := params[name]
+		if !has {
+			return fmt.Errorf("Unknown parameter %q of operation %s", name, op.Type)
+		}
+		if err := param.Check(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check returns error if value is not of the parameter's type,
+// or it is a number or duration out of the parameter's range
+func (ps *ParamSpec) Check(value string) error {
+	var n float64
+	var err error
+	switch ps.Type {
+	case ParamTypeInt:
+		var i int
+		i, err = strconv.Atoi(value)
+		n = float64(i)
+	case ParamTypeFloat:
+		n, err = strconv.ParseFloat(value, 64)
+	case ParamTypeDuration:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		n = float64(d)
+	case ParamTypeSignal:
+		_, err = ParseSignal(value)
+	}
+	if err != nil {
+		return fmt.Errorf("Bad value %q of parameter %q, should be %s", value, ps.Name, ps.Type)
+	}
+	switch {
+	case ps.Positive && n <= 0:
+		return fmt.Errorf("Bad value %q of parameter %q, should be greater than zero", value, ps.Name)
+	case !ps.AllowNegative && n < 0:
+		return fmt.Errorf("Bad value %q of parameter %q, can't be negative", value, ps.Name)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// signals operations can send, by name, with their Linux numbers
+var signals = map[string]int{
+	"SIGHUP":  1,
+	"SIGINT":  2,
+	"SIGQUIT": 3,
+	"SIGABRT": 6,
+	"SIGKILL": 9,
+	"SIGUSR1": 10,
+	"SIGUSR2": 12,
+	"SIGPIPE": 13,
+	"SIGTERM": 15,
+	"SIGCONT": 18,
+	"SIGSTOP": 19,
+	"SIGTSTP": 20,
+}
+
+// ParseSignal returns name of the signal given by name, with or
+// without SIG prefix, or by number. Only known signals are accepted,
+// so the name is safe to pass to commands run in the entities.
+func ParseSignal(signal string) (string, error) {
+	if n, err := strconv.Atoi(signal); err == nil {
+		for name, number := range signals {
+			if number == n {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("Unknown signal %q", signal)
+	}
+	name := strings.ToUpper(signal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if _, has := signals[name]; !has {
+		return "", fmt.Errorf("Unknown signal %q", signal)
+	}
+	return name, nil
+}
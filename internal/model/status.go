@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+type (
+	// StatusChange is a change of entity's status observed by the playground
+	StatusChange struct {
+		Time     time.Time
+		EntityID string
+		Name     string
+		Type     EntityType
+		Status   StatusType
+		// Reason is what caused the change, e.g. event's name
+		Reason string
+	}
+
+	// StatusNotifier is implemented by playgrounds that observe
+	// status changes of their entities as they happen
+	StatusNotifier interface {
+		// NotifyStatus makes playground call listener on every status change
+		NotifyStatus(listener func(StatusChange))
+	}
+
+	// NodeHealth is health of the API playground reaches node through
+	NodeHealth struct {
+		// Node is hostname of the node, empty for the node
+		// playground's API runs on
+		Node string `json:"node"`
+		// Playground is name of the playground, set by the engine
+		Playground string `json:"playground,omitempty"`
+		Healthy    bool   `json:"healthy"`
+		// Failures is number of consecutive failed requests
+		Failures  int       `json:"failures"`
+		LastError string    `json:"last_error,omitempty"`
+		LastCheck time.Time `json:"last_check,omitempty"`
+	}
+
+	// HealthReporter is implemented by playgrounds that
+	// track health of the APIs of their nodes
+	HealthReporter interface {
+		Health() []NodeHealth
+	}
+)
@@ -0,0 +1,38 @@
+package model
+
+import "context"
+
+type (
+	// Undo reverts fault injected by an operation
+	Undo interface {
+		Undo(ctx context.Context) error
+		// String tells what undo does, like "unpause"
+		String() string
+	}
+
+	// Reversible is implemented by entities that can tell
+	// how to revert the operations done on them
+	Reversible interface {
+		// DoReversible does operation same as Do, returning handle
+		// that reverts it, or nil if operation can't be undone
+		DoReversible(ctx context.Context, operation Operation) (Undo, error)
+	}
+
+	undoFunc struct {
+		what string
+		f    func(ctx context.Context) error
+	}
+)
+
+// NewUndo returns undo calling f, what tells what f does
+func NewUndo(what string, f func(ctx context.Context) error) Undo {
+	return &undoFunc{what: what, f: f}
+}
+
+func (uf *undoFunc) Undo(ctx context.Context) error {
+	return uf.f(ctx)
+}
+
+func (uf *undoFunc) String() string {
+	return uf.what
+}